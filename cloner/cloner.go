@@ -2,6 +2,7 @@ package cloner
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/signal"
 	"sync"
@@ -18,13 +19,20 @@ var (
 	gCtx   context.Context
 	gAbort context.CancelFunc
 
-	gQueue chan *job
+	gQueues     map[string]*pool
+	gState      *stateDB
+	gConfig     *config
+	gFailedJobs *failedJobs
 )
 
+var errInvalidVerbosity = errors.New("there is invalid data in verbose option, option supports values from -1 to 5")
+
 const (
 	PrgmActionSync = uint8(iota)
 	PrgmActionPrintGroups
 	PrgmActionPrintRepositories
+	PrgmActionMigrate
+	PrgmActionRetryFailed
 )
 
 type Cloner struct{}
@@ -46,10 +54,27 @@ func (m *Cloner) Sync() error {
 	return m.Bootstrap(PrgmActionSync)
 }
 
+func (m *Cloner) Migrate() error {
+	return m.Bootstrap(PrgmActionMigrate)
+}
+
+func (m *Cloner) RetryFailed() error {
+	return m.Bootstrap(PrgmActionRetryFailed)
+}
+
 func (m *Cloner) Bootstrap(action uint8) (e error) {
+	if gConfig, e = loadConfig(); e != nil {
+		return
+	}
+
+	if e = m.setLogLevel(); e != nil {
+		return
+	}
+
 	kernSignal := make(chan os.Signal, 1)
 	signal.Notify(kernSignal, syscall.SIGINT, syscall.SIGTERM, syscall.SIGTERM, syscall.SIGQUIT)
 
+	gFailedJobs = newFailedJobs()
 	gCtx, gAbort = context.WithCancel(context.WithValue(context.Background(), contextKeyKernSignal, kernSignal))
 
 	// main event loop init
@@ -57,48 +82,110 @@ func (m *Cloner) Bootstrap(action uint8) (e error) {
 	wg.Add(1)
 	go m.loop(wg.Done)
 
-	// queue subsystem init
-	wg.Add(1)
-	pool := newPool()
-	gQueue = pool.getJobQueue()
-	go func(done func()) {
-		pool.dispatch()
-		done()
-	}(wg.Done)
+	// queue subsystem init; api and git jobs have their own queues and workers,
+	// so api calls are not stuck behind heavy transfers
+	gQueues = make(map[string]*pool)
+	for _, kind := range []string{jobKindAPI, jobKindGit} {
+		wg.Add(1)
+		pool := newPool(kind)
+		gQueues[kind] = pool
+		go func(done func()) {
+			pool.dispatch()
+			done()
+		}(wg.Done)
+	}
+
+	// the state database is closed and goroutines are stopped on action errors too
+	defer func() {
+		if err := m.destruct(); err != nil {
+			gLog.Warn().Err(err).Msg("Abnormal destruct status!")
+		}
+
+		gLog.Debug().Msg("trying to stop program execution")
+		gAbort()
+
+		gLog.Debug().Msg("waiting for event loop and queue subsystem")
+		wg.Wait()
+	}()
 
 	switch action {
 	case PrgmActionPrintGroups:
-		var gl *glClient
-		gl, e = newGlClient().connect(gCli.Args().Get(0))
-		if e != nil {
+		var gls []*glClient
+		if gls, e = connectEndpoints("profile"); e != nil {
 			return
 		}
-		if e = gl.printGroupsAction(); e != nil {
+		if e = gls[0].preflight(preflightListScopes); e != nil {
+			return
+		}
+		if e = gls[0].printGroupsAction(); e != nil {
 			return
 		}
 	case PrgmActionPrintRepositories:
-		var gl *glClient
-		gl, e = newGlClient().connect(gCli.Args().Get(0))
-		if e != nil {
+		var gls []*glClient
+		if gls, e = connectEndpoints("profile"); e != nil {
+			return
+		}
+		if e = gls[0].preflight(preflightListScopes); e != nil {
+			return
+		}
+		if e = gls[0].printRepositoriesAction(); e != nil {
 			return
 		}
-		if e = gl.printRepositoriesAction(); e != nil {
+	case PrgmActionSync:
+		var gls []*glClient
+		if gls, e = connectEndpoints("profile"); e != nil {
+			return
+		}
+		if e = gls[0].preflight(preflightSyncScopes); e != nil {
+			return
+		}
+		if gState, e = openStateDB(); e != nil {
+			return
+		}
+		if e = gls[0].syncAction(); e != nil {
+			return
+		}
+	case PrgmActionMigrate:
+		var gls []*glClient
+		if gls, e = connectEndpoints("profile", "destination-profile"); e != nil {
+			return
+		}
+		if e = gls[0].preflight(preflightSyncScopes); e != nil {
+			return
+		}
+		if e = gls[1].preflight(preflightDestinationScopes); e != nil {
+			return
+		}
+		if gState, e = openStateDB(); e != nil {
+			return
+		}
+		if e = newMigrator(gls[0], gls[1]).migrateAction(); e != nil {
+			return
+		}
+	case PrgmActionRetryFailed:
+		if e = retryFailedAction(); e != nil {
 			return
 		}
 	default:
 		break
 	}
 
-	if err := m.destruct(); err != nil {
-		gLog.Warn().Err(err).Msg("Abnormal destruct status!")
+	return e
+}
+
+// setLogLevel applies verbose and quite options, verbose 5 is debug and 0 is panic
+func (m *Cloner) setLogLevel() error {
+	verbose := gCli.Int("verbose")
+	if verbose < -1 || verbose > 5 {
+		return errInvalidVerbosity
 	}
 
-	gLog.Debug().Msg("trying to stop program execution")
-	gAbort()
+	zerolog.SetGlobalLevel(zerolog.Level(int8((verbose - 5) * -1)))
+	if verbose == -1 || gCli.Bool("quite") {
+		zerolog.SetGlobalLevel(zerolog.Disabled)
+	}
 
-	gLog.Debug().Msg("waiting for event loop and queue subsystem")
-	wg.Wait()
-	return e
+	return nil
 }
 
 func (m *Cloner) loop(done func()) {
@@ -124,4 +211,11 @@ LOOP:
 	gLog.Debug().Msg("main event loop has been stopped")
 }
 
-func (m *Cloner) destruct() error { return nil }
+func (m *Cloner) destruct() error {
+	if gState == nil {
+		return nil
+	}
+
+	gLog.Debug().Msg("closing state database")
+	return gState.close()
+}
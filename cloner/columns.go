@@ -0,0 +1,289 @@
+package cloner
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+const (
+	defaultGroupColumns   = "id,full_path,full_name,visibility,parent_id,created_at"
+	defaultProjectColumns = "id,path_with_namespace,name,visibility,created_at,last_activity_at"
+)
+
+var errUnknownColumn = errors.New("unknown column")
+
+// getColumns returns columns from --columns flag; column names are json keys of gitlab objects,
+// nested fields are addressed with dots (e.g. statistics.repository_size)
+func getColumns(defaults string) (columns []string) {
+	value := gCli.String("columns")
+	if value == "" {
+		value = defaults
+	}
+
+	for _, column := range strings.Split(value, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+
+	return
+}
+
+func hasStatisticsColumns() bool {
+	for _, column := range append(getColumns(""), gCli.String("sort-by")) {
+		if strings.HasPrefix(column, "statistics") {
+			return true
+		}
+	}
+	return false
+}
+
+// printObjects prints gitlab objects with the selected columns and sort order
+func printObjects(items []interface{}, defaultColumns string) (e error) {
+	objects := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		if objects[i], e = toGenericObject(item); e != nil {
+			return
+		}
+	}
+
+	if sortBy := gCli.String("sort-by"); sortBy != "" {
+		if e = sortObjects(items, objects, sortBy, gCli.Bool("reverse")); e != nil {
+			return
+		}
+	} else if gCli.Bool("reverse") {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+			objects[i], objects[j] = objects[j], objects[i]
+		}
+	}
+
+	columns := getColumns(defaultColumns)
+
+	header := make(table.Row, len(columns))
+	for i, column := range columns {
+		header[i] = column
+	}
+
+	rows := make([]table.Row, len(objects))
+	for i, object := range objects {
+		rows[i] = getRow(object, columns)
+	}
+
+	return printOutput(items, header, rows)
+}
+
+func getRow(object map[string]interface{}, columns []string) table.Row {
+	row := make(table.Row, len(columns))
+	for i, column := range columns {
+		row[i] = formatField(lookupField(object, column))
+	}
+	return row
+}
+
+// objectStreamer prints objects as soon as they are found; only csv and tsv outputs
+// without sorting are streamed, the rest ones need all objects to be rendered
+type objectStreamer struct {
+	columns []string
+	writer  *csv.Writer
+}
+
+// newObjectStreamer prints the header and returns nil if the output can not be streamed
+func newObjectStreamer(defaultColumns string) *objectStreamer {
+	if gCli.String("sort-by") != "" || gCli.Bool("reverse") {
+		return nil
+	}
+
+	streamer := &objectStreamer{
+		columns: getColumns(defaultColumns),
+		writer:  csv.NewWriter(os.Stdout),
+	}
+
+	switch gCli.String("output") {
+	case outputFormatCSV:
+	case outputFormatTSV:
+		streamer.writer.Comma = '\t'
+	default:
+		return nil
+	}
+
+	// write errors are sticky, so they are returned by the next print
+	_ = streamer.writer.Write(streamer.columns)
+	return streamer
+}
+
+func (m *objectStreamer) print(items []interface{}) error {
+	for _, item := range items {
+		object, e := toGenericObject(item)
+		if e != nil {
+			return e
+		}
+
+		row := getRow(object, m.columns)
+
+		record := make([]string, len(row))
+		for i, cell := range row {
+			record[i] = fmt.Sprint(cell)
+		}
+
+		if e = m.writer.Write(record); e != nil {
+			return e
+		}
+	}
+
+	m.writer.Flush()
+	return m.writer.Error()
+}
+
+func sortObjects(items []interface{}, objects []map[string]interface{}, column string, reverse bool) error {
+	found := len(objects) == 0
+	for _, object := range objects {
+		if _, found = lookupFieldOk(object, column); found {
+			break
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%w: %s", errUnknownColumn, column)
+	}
+
+	idx := make([]int, len(objects))
+	for i := range idx {
+		idx[i] = i
+	}
+
+	sort.SliceStable(idx, func(i, j int) bool {
+		cmp := compareFields(lookupField(objects[idx[i]], column), lookupField(objects[idx[j]], column))
+		if reverse {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	sortedItems, sortedObjects := make([]interface{}, len(items)), make([]map[string]interface{}, len(objects))
+	for i, j := range idx {
+		sortedItems[i], sortedObjects[i] = items[j], objects[j]
+	}
+
+	copy(items, sortedItems)
+	copy(objects, sortedObjects)
+	return nil
+}
+
+// toGenericObject converts the object to its json representation;
+// numbers are kept as json.Number so big IDs and sizes are printed as is
+func toGenericObject(item interface{}) (map[string]interface{}, error) {
+	buf, e := json.Marshal(item)
+	if e != nil {
+		return nil, e
+	}
+
+	object := make(map[string]interface{})
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	return object, dec.Decode(&object)
+}
+
+func lookupField(object map[string]interface{}, path string) interface{} {
+	value, _ := lookupFieldOk(object, path)
+	return value
+}
+
+func lookupFieldOk(object map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = object
+
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if value, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+func formatField(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		buf := make([]string, len(v))
+		for i, item := range v {
+			buf[i] = fmt.Sprint(formatField(item))
+		}
+		return strings.Join(buf, ",")
+	case map[string]interface{}:
+		buf, _ := json.Marshal(v)
+		return string(buf)
+	default:
+		return v
+	}
+}
+
+// compareFields compares json values; numbers are compared numerically, nils go first
+func compareFields(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		// integers are compared as is, big IDs lose precision as floats
+		ai, ae := an.Int64()
+		bi, be := bn.Int64()
+		if ae == nil && be == nil {
+			switch {
+			case ai < bi:
+				return -1
+			case ai > bi:
+				return 1
+			}
+			return 0
+		}
+
+		af, _ := an.Float64()
+		bf, _ := bn.Float64()
+
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+
+	ab, aok := a.(bool)
+	bb, bok := b.(bool)
+	if aok && bok {
+		switch {
+		case ab == bb:
+			return 0
+		case !ab:
+			return -1
+		}
+		return 1
+	}
+
+	return strings.Compare(fmt.Sprint(formatField(a)), fmt.Sprint(formatField(b)))
+}
@@ -0,0 +1,98 @@
+package cloner
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompareFields(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b interface{}
+		want int
+	}{
+		{"nils", nil, nil, 0},
+		{"nil goes first", nil, json.Number("0"), -1},
+		{"nil goes first (reversed)", json.Number("0"), nil, 1},
+		{"nil before string", nil, "", -1},
+		{"numbers are compared numerically", json.Number("9"), json.Number("10"), -1},
+		{"floats", json.Number("1.5"), json.Number("1.25"), 1},
+		{"equal numbers", json.Number("42"), json.Number("42.0"), 0},
+		{"big ids", json.Number("9007199254740993"), json.Number("9007199254740992"), 1},
+		{"integer and float", json.Number("2"), json.Number("1.5"), 1},
+		{"false before true", false, true, -1},
+		{"equal bools", true, true, 0},
+		{"strings", "a", "b", -1},
+		{"number and string", json.Number("10"), "9", -1},
+		{"lists", []interface{}{"a", "b"}, []interface{}{"a", "c"}, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareFields(tt.a, tt.b); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortObjects(t *testing.T) {
+	newObjects := func() ([]interface{}, []map[string]interface{}) {
+		raw := []string{
+			`{"name":"b","stats":{"size":10}}`,
+			`{"name":"a","stats":null}`,
+			`{"name":"c","stats":{"size":9}}`,
+			`{"name":"d"}`,
+			`{"name":"e","stats":{"size":100}}`,
+		}
+
+		items, objects := make([]interface{}, len(raw)), make([]map[string]interface{}, len(raw))
+		for i, buf := range raw {
+			var e error
+			if objects[i], e = toGenericObject(json.RawMessage(buf)); e != nil {
+				t.Fatal(e)
+			}
+			items[i] = objects[i]["name"]
+		}
+		return items, objects
+	}
+
+	tests := []struct {
+		name    string
+		column  string
+		reverse bool
+		want    []interface{}
+		err     error
+	}{
+		{"strings", "name", false, []interface{}{"a", "b", "c", "d", "e"}, nil},
+		{"strings reversed", "name", true, []interface{}{"e", "d", "c", "b", "a"}, nil},
+		{"nils and numbers", "stats.size", false, []interface{}{"a", "d", "c", "b", "e"}, nil},
+		{"nils and numbers reversed", "stats.size", true, []interface{}{"e", "b", "c", "a", "d"}, nil},
+		{"unknown column", "stats.count", false, nil, errUnknownColumn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, objects := newObjects()
+
+			e := sortObjects(items, objects, tt.column, tt.reverse)
+			if !errors.Is(e, tt.err) {
+				t.Fatalf("got error %v, want %v", e, tt.err)
+			} else if e != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(items, tt.want) {
+				t.Errorf("got %v, want %v", items, tt.want)
+			}
+
+			for i, object := range objects {
+				if object["name"] != items[i] {
+					t.Errorf("object %d is %v, item is %v", i, object["name"], items[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package cloner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	errUnknownProfile = errors.New("there is no such profile in the config file")
+	errUnknownSetting = errors.New("there is no such option")
+	errNoEndpoint     = errors.New("gitlab url or profile must be specified")
+)
+
+type (
+	configProfile struct {
+		URL          string                 `yaml:"url"`
+		Token        string                 `yaml:"token"`
+		TokenEnv     string                 `yaml:"token_env"`
+		TokenFile    string                 `yaml:"token_file"`
+		TokenCommand string                 `yaml:"token_command"`
+		AuthType     string                 `yaml:"auth_type"`
+		Username     string                 `yaml:"username"`
+		Settings     map[string]interface{} `yaml:"settings"`
+	}
+	config struct {
+		Settings map[string]interface{}    `yaml:"settings"`
+		Profiles map[string]*configProfile `yaml:"profiles"`
+	}
+)
+
+func getDefaultConfigPath() string {
+	dir, e := os.UserConfigDir()
+	if e != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "gitlabrepocloner", "config.yaml")
+}
+
+// loadConfig reads the config file and applies its settings (global ones and settings of
+// the --profile profile, the latter have priority) to all options which are not set in
+// the command line
+func loadConfig() (*config, error) {
+	cfg := &config{}
+
+	path := gCli.String("config")
+	if path == "" {
+		path = getDefaultConfigPath()
+	}
+
+	buf, e := os.ReadFile(path)
+	if errors.Is(e, os.ErrNotExist) && !gCli.IsSet("config") {
+		gLog.Debug().Msgf("there is no config file %s, skipping", path)
+		return cfg, nil
+	} else if e != nil {
+		return nil, e
+	}
+
+	if e = yaml.Unmarshal(buf, cfg); e != nil {
+		return nil, fmt.Errorf("could not parse config file %s: %w", path, e)
+	}
+
+	gLog.Debug().Msgf("config file %s has been loaded", path)
+
+	settings := make(map[string]interface{}, len(cfg.Settings))
+	for name, value := range cfg.Settings {
+		settings[name] = value
+	}
+
+	if name := gCli.String("profile"); name != "" {
+		var profile *configProfile
+		if profile, e = cfg.getProfile(name); e != nil {
+			return nil, e
+		}
+
+		for name, value := range profile.Settings {
+			settings[name] = value
+		}
+	}
+
+	if e = applySettings(settings); e != nil {
+		return nil, e
+	}
+
+	return cfg, nil
+}
+
+func (m *config) getProfile(name string) (*configProfile, error) {
+	profile, ok := m.Profiles[name]
+	if !ok || profile == nil {
+		return nil, fmt.Errorf("%w: %s", errUnknownProfile, name)
+	}
+
+	return profile, nil
+}
+
+// applySettings sets options of the current command; settings of other commands are skipped,
+// unknown ones are errors
+func applySettings(settings map[string]interface{}) error {
+	for name, value := range settings {
+		if gCli.Value(name) == nil {
+			if !isAppFlag(gCli, name) {
+				return fmt.Errorf("%w: %s", errUnknownSetting, name)
+			}
+
+			gLog.Debug().Msgf("option %s is not supported by the command, skipping the setting", name)
+			continue
+		} else if gCli.IsSet(name) {
+			continue
+		}
+
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+
+		for _, v := range values {
+			if e := setFlag(gCli, name, fmt.Sprint(v)); e != nil {
+				return e
+			}
+		}
+	}
+
+	return nil
+}
+
+// setFlag sets the flag value in the context that defines the flag (global flags
+// are defined in the root context, command flags in the command one)
+func setFlag(c *cli.Context, name, value string) error {
+	for _, ctx := range c.Lineage() {
+		if ctx.Set(name, value) == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", errUnknownSetting, name)
+}
+
+// isAppFlag reports whether the flag is defined by the app or any of its commands;
+// subcommands are run as separate apps, so all apps of the context lineage are checked
+func isAppFlag(c *cli.Context, name string) bool {
+	var hasFlag func(flags []cli.Flag, commands []*cli.Command) bool
+	hasFlag = func(flags []cli.Flag, commands []*cli.Command) bool {
+		for _, flag := range flags {
+			for _, flagName := range flag.Names() {
+				if flagName == name {
+					return true
+				}
+			}
+		}
+
+		for _, command := range commands {
+			if hasFlag(command.Flags, command.Subcommands) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, ctx := range c.Lineage() {
+		if ctx.App != nil && hasFlag(ctx.App.Flags, ctx.App.Commands) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getEndpoints returns gitlab instance profiles for the command; profiles from the given
+// flags have priority, the rest urls are taken from command arguments in order
+func getEndpoints(profileFlags ...string) (profiles []*configProfile, e error) {
+	args := gCli.Args().Slice()
+
+	for _, flag := range profileFlags {
+		if name := gCli.String(flag); name != "" {
+			var profile *configProfile
+			if profile, e = gConfig.getProfile(name); e != nil {
+				return
+			}
+
+			profiles = append(profiles, profile)
+			continue
+		}
+
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%w (see --%s)", errNoEndpoint, flag)
+		}
+
+		profiles, args = append(profiles, &configProfile{URL: args[0]}), args[1:]
+	}
+
+	return
+}
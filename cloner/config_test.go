@@ -0,0 +1,141 @@
+package cloner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+const testConfig = `
+settings:
+  target-dir: /global
+  output: json
+  queue-workers: 4
+profiles:
+  old:
+    url: https://old.example.com
+    settings:
+      target-dir: /profile
+`
+
+// runTestApp runs the app with the main.go command layout and returns option values
+// of the called command after the config is loaded
+func runTestApp(t *testing.T, config string, args ...string) (map[string]string, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if e := os.WriteFile(path, []byte(config), 0600); e != nil {
+		t.Fatal(e)
+	}
+
+	values := make(map[string]string)
+	action := func(c *cli.Context) error {
+		log := zerolog.Nop()
+		gLog, gCli = &log, c
+
+		if _, e := loadConfig(); e != nil {
+			return e
+		}
+
+		for _, name := range []string{"target-dir", "output", "queue-workers"} {
+			if v := c.Value(name); v != nil {
+				values[name] = c.String(name)
+			}
+		}
+
+		return nil
+	}
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "config"},
+			&cli.StringFlag{Name: "profile"},
+			&cli.IntFlag{Name: "queue-workers", Value: 1},
+		},
+		Commands: []*cli.Command{
+			{
+				Name: "list",
+				Subcommands: []*cli.Command{{
+					Name:   "repositories",
+					Flags:  []cli.Flag{&cli.StringFlag{Name: "output", Value: "table"}},
+					Action: action,
+				}},
+			},
+			{
+				Name:   "sync",
+				Flags:  []cli.Flag{&cli.StringFlag{Name: "target-dir"}},
+				Action: action,
+			},
+		},
+	}
+
+	return values, app.Run(append([]string{"app", "--config", path}, args...))
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		args   []string
+		want   map[string]string
+		err    error
+	}{
+		{
+			name: "global settings",
+			args: []string{"sync"},
+			want: map[string]string{"target-dir": "/global", "queue-workers": "4"},
+		},
+		{
+			name: "profile overrides global settings",
+			args: []string{"--profile", "old", "sync"},
+			want: map[string]string{"target-dir": "/profile", "queue-workers": "4"},
+		},
+		{
+			name: "command line overrides settings",
+			args: []string{"--profile", "old", "--queue-workers", "8", "sync", "--target-dir", "/cli"},
+			want: map[string]string{"target-dir": "/cli", "queue-workers": "8"},
+		},
+		{
+			name: "options of other commands are skipped",
+			args: []string{"list", "repositories"},
+			want: map[string]string{"output": "json", "queue-workers": "4"},
+		},
+		{
+			name:   "unknown settings are errors",
+			config: "settings:\n  target-directory: /typo\n",
+			args:   []string{"sync"},
+			err:    errUnknownSetting,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			if config == "" {
+				config = testConfig
+			}
+
+			values, e := runTestApp(t, config, tt.args...)
+			if !errors.Is(e, tt.err) {
+				t.Fatalf("got error %v, want %v", e, tt.err)
+			} else if e != nil {
+				return
+			}
+
+			for name, want := range tt.want {
+				if values[name] != want {
+					t.Errorf("got %s %q, want %q", name, values[name], want)
+				}
+			}
+			for name := range values {
+				if _, ok := tt.want[name]; !ok {
+					t.Errorf("got unexpected option %s", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package cloner
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errNoToken           = errors.New("there is no api token for the gitlab instance")
+	errCredentialCommand = errors.New("credential command has been failed")
+)
+
+// tokenSource describes where the api token of the instance may be found
+type tokenSource struct {
+	env     string
+	file    string
+	command string
+}
+
+// getTokenSource returns token sources of the profile (if any) and options with the given
+// prefix ("" for the source instance, "destination-" for the migrate destination)
+func getTokenSource(profile *configProfile, flagPrefix string) *tokenSource {
+	source := &tokenSource{
+		env:     gCli.String(flagPrefix + "token-env"),
+		file:    gCli.String(flagPrefix + "token-file"),
+		command: gCli.String(flagPrefix + "token-command"),
+	}
+
+	if profile.TokenEnv != "" {
+		source.env = profile.TokenEnv
+	}
+	if profile.TokenFile != "" {
+		source.file = profile.TokenFile
+	}
+	if profile.TokenCommand != "" {
+		source.command = profile.TokenCommand
+	}
+
+	// the default environment variable must not shadow explicitly configured sources
+	envIsSet := gCli.IsSet(flagPrefix+"token-env") || profile.TokenEnv != ""
+	if !envIsSet && (source.file != "" || source.command != "") {
+		source.env = ""
+	}
+
+	return source
+}
+
+// resolveToken looks for the api token of the instance in the environment variable,
+// the token file, the credential command and the netrc file in this order
+func (m *glClient) resolveToken(source *tokenSource) (e error) {
+	if source.env != "" {
+		if m.apiToken = strings.TrimSpace(os.Getenv(source.env)); m.apiToken != "" {
+			gLog.Debug().Msgf("api token has been loaded from %s environment variable", source.env)
+			return
+		}
+	}
+
+	if source.file != "" {
+		if m.apiToken, e = readTokenFile(source.file); e != nil {
+			return
+		}
+		gLog.Debug().Msgf("api token has been loaded from %s file", source.file)
+		return
+	}
+
+	if source.command != "" {
+		if m.apiUser, m.apiToken, e = m.runCredentialCommand(source.command); e != nil {
+			return
+		}
+		gLog.Debug().Msg("api token has been loaded from the credential command")
+		return
+	}
+
+	if m.apiUser, m.apiToken, e = lookupNetrc(getNetrcPath(), m.endpoint.Hostname()); e != nil {
+		return
+	} else if m.apiToken != "" {
+		gLog.Debug().Msgf("api token has been loaded from netrc for %s", m.endpoint.Hostname())
+		return
+	}
+
+	return fmt.Errorf("%w %s", errNoToken, m.endpoint.Host)
+}
+
+func readTokenFile(path string) (string, error) {
+	if strings.HasPrefix(path, "~/") {
+		if home, e := os.UserHomeDir(); e == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+
+	buf, e := os.ReadFile(path)
+	if e != nil {
+		return "", e
+	}
+
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// runCredentialCommand calls the command with "get" argument like git credential helpers;
+// the instance description is passed to stdin and username/password are read from stdout
+func (m *glClient) runCredentialCommand(command string) (username, password string, e error) {
+	args := append(strings.Fields(command), "get")
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\n\n", m.endpoint.Scheme, m.endpoint.Host))
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	if e = cmd.Run(); e != nil {
+		return "", "", fmt.Errorf("%w: %v: %s", errCredentialCommand, e, strings.TrimSpace(stderr.String()))
+	}
+
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "username":
+			username = kv[1]
+		case "password":
+			password = kv[1]
+		}
+	}
+
+	if password == "" {
+		return "", "", fmt.Errorf("%w: there is no password in the command output", errCredentialCommand)
+	}
+
+	return
+}
+
+func getNetrcPath() string {
+	if path := gCli.String("netrc-file"); path != "" {
+		return path
+	} else if path = os.Getenv("NETRC"); path != "" {
+		return path
+	}
+
+	home, e := os.UserHomeDir()
+	if e != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".netrc")
+}
+
+// lookupNetrc returns login and password of the machine (or the default entry);
+// a missing netrc file is not an error
+func lookupNetrc(path, host string) (login, password string, e error) {
+	buf, e := os.ReadFile(path)
+	if errors.Is(e, os.ErrNotExist) || path == "" {
+		return "", "", nil
+	} else if e != nil {
+		return
+	}
+
+	var matched, found bool
+	fields := getNetrcFields(buf)
+
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if found {
+				return
+			}
+			i++
+			matched = i < len(fields) && fields[i] == host
+		case "default":
+			if found {
+				return
+			}
+			matched = true
+		case "login", "password", "account":
+			if i++; i >= len(fields) || !matched {
+				continue
+			}
+
+			found = true
+			if fields[i-1] == "login" {
+				login = fields[i]
+			} else if fields[i-1] == "password" {
+				password = fields[i]
+			}
+		}
+	}
+
+	return
+}
+
+// getNetrcFields splits the netrc file into tokens; macro definitions are skipped
+// up to the empty line ending them
+func getNetrcFields(buf []byte) (fields []string) {
+	var macro bool
+
+	for _, line := range strings.Split(string(buf), "\n") {
+		if macro {
+			macro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		tokens := strings.Fields(line)
+		for i, token := range tokens {
+			if token == "macdef" {
+				tokens, macro = tokens[:i], true
+				break
+			}
+		}
+
+		fields = append(fields, tokens...)
+	}
+
+	return
+}
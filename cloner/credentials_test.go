@@ -0,0 +1,97 @@
+package cloner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupNetrc(t *testing.T) {
+	tests := []struct {
+		name     string
+		netrc    string
+		login    string
+		password string
+	}{
+		{
+			name:     "machine on one line",
+			netrc:    "machine gitlab.example.com login user password token",
+			login:    "user",
+			password: "token",
+		},
+		{
+			name:     "machine on several lines",
+			netrc:    "machine gitlab.example.com\n  login user\n  password token\n",
+			login:    "user",
+			password: "token",
+		},
+		{
+			name:     "other machines are skipped",
+			netrc:    "machine other.example.com login other password secret\nmachine gitlab.example.com login user password token",
+			login:    "user",
+			password: "token",
+		},
+		{
+			name:     "account is not a password",
+			netrc:    "machine gitlab.example.com login user account acc password token",
+			login:    "user",
+			password: "token",
+		},
+		{
+			name:  "unknown machine without default",
+			netrc: "machine other.example.com login other password secret",
+		},
+		{
+			name:     "default is used for unknown machine",
+			netrc:    "machine other.example.com login other password secret\ndefault login anonymous password fallback",
+			login:    "anonymous",
+			password: "fallback",
+		},
+		{
+			name:     "machine has priority over default",
+			netrc:    "machine gitlab.example.com login user password token\ndefault login anonymous password fallback",
+			login:    "user",
+			password: "token",
+		},
+		{
+			name:     "machine after macro definition",
+			netrc:    "macdef init\ncd /pub\nbinary\n\nmachine gitlab.example.com login user password token",
+			login:    "user",
+			password: "token",
+		},
+		{
+			name:     "macro body is not parsed",
+			netrc:    "machine other.example.com login other password secret macdef init\nmachine gitlab.example.com password evil\n\ndefault password fallback",
+			password: "fallback",
+		},
+		{
+			name:  "empty file",
+			netrc: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".netrc")
+			if e := os.WriteFile(path, []byte(tt.netrc), 0600); e != nil {
+				t.Fatal(e)
+			}
+
+			login, password, e := lookupNetrc(path, "gitlab.example.com")
+			if e != nil {
+				t.Fatalf("unexpected error: %v", e)
+			}
+
+			if login != tt.login || password != tt.password {
+				t.Errorf("got %q/%q, want %q/%q", login, password, tt.login, tt.password)
+			}
+		})
+	}
+}
+
+func TestLookupNetrcMissingFile(t *testing.T) {
+	login, password, e := lookupNetrc(filepath.Join(t.TempDir(), "missing"), "gitlab.example.com")
+	if e != nil || login != "" || password != "" {
+		t.Errorf("got %q/%q/%v, want empty credentials without error", login, password, e)
+	}
+}
@@ -0,0 +1,252 @@
+package cloner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+var (
+	errNoFailedJobsFile    = errors.New("failed jobs report is not specified, see --failed-jobs-file and --target-dir")
+	errUnknownFailedAction = errors.New("failed jobs report has unknown action")
+)
+
+type (
+	failedJob struct {
+		Kind     string          `json:"kind"`
+		Name     string          `json:"name"`
+		Status   string          `json:"status"`
+		Attempts int             `json:"attempts"`
+		Error    string          `json:"error"`
+		Args     json.RawMessage `json:"args"`
+	}
+
+	// failedJobsReport is written at the end of sync and migrate runs; project jobs are
+	// named after the action and keep the whole project, so they are rerun without discovery
+	failedJobsReport struct {
+		Action     string       `json:"action"`
+		TargetDir  string       `json:"target_dir"`
+		Mirror     bool         `json:"mirror"`
+		FinishedAt time.Time    `json:"finished_at"`
+		Jobs       []*failedJob `json:"jobs"`
+	}
+
+	// failedJobs is the dead-letter list of jobs failed after all attempts or aborted
+	failedJobs struct {
+		jobs []*failedJob
+		mu   sync.Mutex
+	}
+)
+
+func newFailedJobs() *failedJobs {
+	return &failedJobs{}
+}
+
+func (m *failedJobs) add(kind, name string, args interface{}, jb *job) {
+	failed := &failedJob{
+		Kind:     kind,
+		Name:     name,
+		Status:   "failure",
+		Attempts: jb.attempts,
+	}
+
+	if jb.status == jobStatusAborted {
+		failed.Status = "aborted"
+	}
+
+	if jb.lastErr != nil {
+		failed.Error = jb.lastErr.Error()
+	}
+
+	var e error
+	if failed.Args, e = json.Marshal(args); e != nil {
+		gLog.Warn().Err(e).Msgf("could not save arguments of the failed %s job", name)
+		failed.Args = json.RawMessage("null")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobs = append(m.jobs, failed)
+}
+
+// restore keeps jobs of the previous report which are not rerun, so they are not lost
+// on the report rewrite
+func (m *failedJobs) restore(jobs []*failedJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobs = append(m.jobs, jobs...)
+}
+
+func (m *failedJobs) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.jobs)
+}
+
+func getFailedJobsPath(targetDir string) string {
+	if path := gCli.String("failed-jobs-file"); path != "" {
+		return path
+	}
+
+	return filepath.Join(targetDir, ".gitlabrepocloner-failed.json")
+}
+
+// write saves the report of the action run; the report of the previous run is removed
+// if there are no failed jobs and the run has not been cancelled
+func (m *failedJobs) write(action, targetDir string, mirror bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := getFailedJobsPath(targetDir)
+
+	if len(m.jobs) == 0 {
+		if gCtx.Err() != nil {
+			return nil
+		}
+
+		if e := os.Remove(path); e != nil && !errors.Is(e, os.ErrNotExist) {
+			return e
+		}
+		return nil
+	}
+
+	buf, e := json.MarshalIndent(&failedJobsReport{
+		Action:     action,
+		TargetDir:  targetDir,
+		Mirror:     mirror,
+		FinishedAt: time.Now(),
+		Jobs:       m.jobs,
+	}, "", "  ")
+	if e != nil {
+		return e
+	}
+
+	if e = os.WriteFile(path, buf, 0644); e != nil {
+		return e
+	}
+
+	gLog.Warn().Msgf("%d jobs have been failed, see %s; they may be rerun with retry-failed command", len(m.jobs), path)
+	return nil
+}
+
+func loadFailedJobsReport(path string) (*failedJobsReport, error) {
+	buf, e := os.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+
+	report := &failedJobsReport{}
+	if e = json.Unmarshal(buf, report); e != nil {
+		return nil, fmt.Errorf("could not parse failed jobs report %s: %w", path, e)
+	}
+
+	return report, nil
+}
+
+// getProjects returns projects of failed action jobs and the rest jobs
+// (discovery jobs can not be rerun separately)
+func (m *failedJobsReport) getProjects() (projects []*gitlab.Project, skipped []*failedJob) {
+	for _, failed := range m.Jobs {
+		if failed.Name != m.Action {
+			skipped = append(skipped, failed)
+			continue
+		}
+
+		project := &gitlab.Project{}
+		if e := json.Unmarshal(failed.Args, project); e != nil || project.ID == 0 {
+			gLog.Warn().Err(e).Msgf("could not read the project of the failed %s job, skipping", failed.Name)
+			skipped = append(skipped, failed)
+			continue
+		}
+
+		projects = append(projects, project)
+	}
+
+	return
+}
+
+// retryFailedAction reruns failed projects of the last sync or migrate run
+func retryFailedAction() (e error) {
+	if gCli.String("failed-jobs-file") == "" && gCli.String("target-dir") == "" {
+		return errNoFailedJobsFile
+	}
+
+	path := getFailedJobsPath(gCli.String("target-dir"))
+
+	var report *failedJobsReport
+	if report, e = loadFailedJobsReport(path); e != nil {
+		return
+	}
+
+	projects, skipped := report.getProjects()
+	if len(skipped) != 0 {
+		gLog.Warn().Msgf("%d failed jobs are not project ones and can not be retried, run %s again to find all projects", len(skipped), report.Action)
+		gFailedJobs.restore(skipped)
+	}
+
+	if len(projects) == 0 {
+		gLog.Info().Msgf("there are no failed projects in %s", path)
+		if len(skipped) != 0 {
+			return errSyncFailed
+		}
+		return nil
+	}
+
+	// options have priority over settings of the failed run
+	if !gCli.IsSet("target-dir") {
+		if e = setFlag(gCli, "target-dir", report.TargetDir); e != nil {
+			return
+		}
+	}
+	if !gCli.IsSet("mirror") {
+		if e = setFlag(gCli, "mirror", strconv.FormatBool(report.Mirror)); e != nil {
+			return
+		}
+	}
+
+	gLog.Info().Msgf("retrying %d failed projects of %s from %s", len(projects), report.Action, path)
+
+	var gls []*glClient
+
+	switch report.Action {
+	case "sync":
+		if gls, e = connectEndpoints("profile"); e != nil {
+			return
+		}
+		if e = gls[0].preflight(preflightSyncScopes); e != nil {
+			return
+		}
+		if gState, e = openStateDB(); e != nil {
+			return
+		}
+
+		return gls[0].syncProjectsAsync(projects)
+	case "migrate":
+		if gls, e = connectEndpoints("profile", "destination-profile"); e != nil {
+			return
+		}
+		if e = gls[0].preflight(preflightSyncScopes); e != nil {
+			return
+		}
+		if e = gls[1].preflight(preflightDestinationScopes); e != nil {
+			return
+		}
+		if gState, e = openStateDB(); e != nil {
+			return
+		}
+
+		return runProjectJobsAsync("migrate", gCli.String("target-dir"), true, projects, newMigrator(gls[0], gls[1]).migrateProject)
+	default:
+		return fmt.Errorf("%w: %s", errUnknownFailedAction, report.Action)
+	}
+}
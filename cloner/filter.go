@@ -0,0 +1,200 @@
+package cloner
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+const (
+	filterModeInclude = "include"
+	filterModeExclude = "exclude"
+	filterModeOnly    = "only"
+)
+
+var errInvalidFilter = errors.New("invalid project filter")
+
+type projectFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+
+	visibility map[gitlab.VisibilityValue]bool
+	topics     map[string]bool
+
+	archived string
+	forks    string
+
+	activeWithin time.Duration
+	inactiveFor  time.Duration
+
+	manifest *manifest
+}
+
+func newProjectFilter() (filter *projectFilter, e error) {
+	filter = &projectFilter{
+		visibility: make(map[gitlab.VisibilityValue]bool),
+		topics:     make(map[string]bool),
+
+		archived: gCli.String("archived"),
+		forks:    gCli.String("forks"),
+
+		activeWithin: gCli.Duration("active-within"),
+		inactiveFor:  gCli.Duration("inactive-for"),
+	}
+
+	if filename := gCli.String("manifest"); filename != "" {
+		if filter.manifest, e = loadManifest(filename); e != nil {
+			return
+		}
+	}
+
+	if filter.include, e = compileRegexps(gCli.StringSlice("include")); e != nil {
+		return
+	}
+
+	if filter.exclude, e = compileRegexps(gCli.StringSlice("exclude")); e != nil {
+		return
+	}
+
+	for _, visibility := range gCli.StringSlice("visibility") {
+		switch v := gitlab.VisibilityValue(visibility); v {
+		case gitlab.PublicVisibility, gitlab.InternalVisibility, gitlab.PrivateVisibility:
+			filter.visibility[v] = true
+		default:
+			return nil, fmt.Errorf("%w: unknown visibility %s", errInvalidFilter, visibility)
+		}
+	}
+
+	for _, topic := range gCli.StringSlice("topic") {
+		filter.topics[topic] = true
+	}
+
+	for _, mode := range []string{filter.archived, filter.forks} {
+		switch mode {
+		case "", filterModeInclude, filterModeExclude, filterModeOnly:
+		default:
+			return nil, fmt.Errorf("%w: unknown mode %s", errInvalidFilter, mode)
+		}
+	}
+
+	// graphql projects have no fork relations, so such filter would silently match nothing
+	if useGraphQL() && filter.forks != "" && filter.forks != filterModeInclude {
+		return nil, fmt.Errorf("%w: forks mode %s is not supported by %s api backend", errInvalidFilter, filter.forks, apiBackendGraphQL)
+	}
+
+	return
+}
+
+func compileRegexps(expressions []string) (regexps []*regexp.Regexp, e error) {
+	regexps = make([]*regexp.Regexp, len(expressions))
+
+	for i, expression := range expressions {
+		if regexps[i], e = regexp.Compile(expression); e != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidFilter, e)
+		}
+	}
+
+	return
+}
+
+// filterProjects applies project filter flags to the found projects
+func filterProjects(projects []*gitlab.Project) ([]*gitlab.Project, error) {
+	filter, e := newProjectFilter()
+	if e != nil {
+		return nil, e
+	}
+
+	filtered := filter.apply(projects)
+
+	gLog.Info().Msgf("%d of %d projects have been matched by filters", len(filtered), len(projects))
+	return filtered, nil
+}
+
+func (m *projectFilter) apply(projects []*gitlab.Project) []*gitlab.Project {
+	filtered := make([]*gitlab.Project, 0, len(projects))
+	for _, project := range projects {
+		if reason, ok := m.match(project); !ok {
+			gLog.Debug().Msgf("project %s has been filtered out: %s", project.PathWithNamespace, reason)
+			continue
+		}
+
+		filtered = append(filtered, project)
+	}
+
+	return filtered
+}
+
+// match returns false and the reason if the project must be skipped
+func (m *projectFilter) match(project *gitlab.Project) (string, bool) {
+	if m.manifest != nil {
+		if reason, ok := m.manifest.match(project); !ok {
+			return reason, false
+		}
+	}
+
+	if len(m.include) != 0 && !matchAnyRegexp(m.include, project.PathWithNamespace) {
+		return "path is not matched by include expressions", false
+	}
+
+	if matchAnyRegexp(m.exclude, project.PathWithNamespace) {
+		return "path is matched by exclude expressions", false
+	}
+
+	if len(m.visibility) != 0 && !m.visibility[project.Visibility] {
+		return "visibility is " + string(project.Visibility), false
+	}
+
+	if !matchMode(m.archived, project.Archived) {
+		return "archived state does not match", false
+	}
+
+	if !matchMode(m.forks, project.ForkedFromProject != nil) {
+		return "fork state does not match", false
+	}
+
+	if m.activeWithin != 0 && (project.LastActivityAt == nil || time.Since(*project.LastActivityAt) > m.activeWithin) {
+		return "there is no activity within " + m.activeWithin.String(), false
+	}
+
+	if m.inactiveFor != 0 && project.LastActivityAt != nil && time.Since(*project.LastActivityAt) < m.inactiveFor {
+		return "there is activity within " + m.inactiveFor.String(), false
+	}
+
+	if len(m.topics) != 0 && !m.hasTopic(project) {
+		return "there are no matched topics", false
+	}
+
+	return "", true
+}
+
+func (m *projectFilter) hasTopic(project *gitlab.Project) bool {
+	// TagList is filled by gitlab versions older than 14.0
+	for _, topic := range append(project.Topics, project.TagList...) {
+		if m.topics[topic] {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyRegexp(regexps []*regexp.Regexp, value string) bool {
+	for _, re := range regexps {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchMode(mode string, value bool) bool {
+	switch mode {
+	case filterModeExclude:
+		return !value
+	case filterModeOnly:
+		return value
+	}
+	return true
+}
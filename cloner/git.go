@@ -0,0 +1,99 @@
+package cloner
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var errGitCommandFailed = errors.New("git command has been failed")
+
+type gitCommand struct {
+	ctx context.Context
+
+	dir      string
+	username string
+	password string
+}
+
+// newGitCommand returns git commands bound to the context; the running command
+// is killed when the context is done
+func newGitCommand(ctx context.Context, dir, username, password string) *gitCommand {
+	return &gitCommand{
+		ctx: ctx,
+
+		dir:      dir,
+		username: username,
+		password: password,
+	}
+}
+
+// credentials are passed through GIT_CONFIG_* environment and never appear in argv
+func (m *gitCommand) environ() []string {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	if m.password != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(m.username + ":" + m.password))
+		env = append(env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+		)
+	}
+
+	return env
+}
+
+func (m *gitCommand) run(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(m.ctx, "git", args...)
+	cmd.Dir = m.dir
+	cmd.Env = m.environ()
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	gLog.Debug().Strs("args", args).Str("dir", m.dir).Msg("running git command")
+
+	if e := cmd.Run(); e != nil {
+		return "", fmt.Errorf("%w: git %s: %v: %s", errGitCommandFailed, args[0], e, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (m *gitCommand) clone(remote, path string) error {
+	_, e := m.run("clone", "--quiet", remote, path)
+	return e
+}
+
+// mirror creates a bare repository with all advertised refs (branches, tags, notes and
+// merge-requests) mapped as is; gitlab hides keep-around refs, so they are not fetched
+func (m *gitCommand) mirror(remote, path string) error {
+	_, e := m.run("clone", "--quiet", "--mirror", remote, path)
+	return e
+}
+
+// push sends all branches, tags and notes to the remote and removes ones missing locally;
+// gitlab denies updates of its hidden refs (merge-requests, keep-around) so they are skipped
+func (m *gitCommand) push(remote string) error {
+	_, e := m.run("push", "--quiet", "--force", "--prune", remote,
+		"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*", "+refs/notes/*:refs/notes/*")
+	return e
+}
+
+func (m *gitCommand) isRepository() bool {
+	_, e := m.run("rev-parse", "--git-dir")
+	return e == nil
+}
+
+// fetch updates all refs of the existing clone and removes refs deleted on the remote side;
+// for mirrors the "+refs/*:refs/*" refspec is used from the repository config
+func (m *gitCommand) fetch() error {
+	_, e := m.run("fetch", "--quiet", "--prune", "--tags", "origin")
+	return e
+}
@@ -1,51 +1,123 @@
 package cloner
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/hashicorp/go-retryablehttp"
 	"github.com/xanzy/go-gitlab"
 )
 
+const (
+	authTypePrivate = "private"
+	authTypeOAuth   = "oauth"
+	authTypeJob     = "job"
+	authTypeBasic   = "basic"
+)
+
+var (
+	errInvalidURL      = errors.New("could not parse gitlab url")
+	errUnknownAuthType = errors.New("unknown auth type")
+	errNoUsername      = errors.New("username is required for basic auth")
+	errListFailed      = errors.New("some groups or projects could not be listed")
+)
+
+// projectsPage is an argument of group projects page jobs
+type projectsPage struct {
+	Group int `json:"group"`
+	Page  int `json:"page"`
+}
+
 type glClient struct {
 	instance *gitlab.Client
 
-	endpoint    *url.URL
-	groupPrefix string
-	apiToken    string
+	endpoint *url.URL
+	authType string
+	apiUser  string
+	apiToken string
 
-	inner http.RoundTripper
+	inner   http.RoundTripper
+	limiter *apiLimiter
 }
 
 func newGlClient() *glClient {
 	return &glClient{}
 }
 
-func (m *glClient) connect(arg string) (*glClient, error) {
+// connectEndpoints connects to gitlab instances from profiles of the given flags or command arguments
+func connectEndpoints(profileFlags ...string) (clients []*glClient, e error) {
+	var profiles []*configProfile
+	if profiles, e = getEndpoints(profileFlags...); e != nil {
+		return
+	}
+
+	for i, profile := range profiles {
+		var gl *glClient
+		if gl, e = newGlClient().connect(profile, strings.TrimSuffix(profileFlags[i], "profile")); e != nil {
+			return
+		}
+
+		clients = append(clients, gl)
+	}
+
+	return
+}
+
+func (m *glClient) connect(profile *configProfile, flagPrefix string) (*glClient, error) {
 	var e error
 
-	if m.endpoint, e = url.Parse(arg); e != nil {
-		return m, e
+	// url.Parse error contains the url, so it must not be logged with the token inside
+	if m.endpoint, e = url.Parse(profile.URL); e != nil {
+		return m, errInvalidURL
 	}
 
-	buf := strings.Split(m.endpoint.EscapedPath(), "/")
-	if len(buf) > 0 {
-		m.groupPrefix = buf[len(buf)-1]
-		m.endpoint.Path = "/" + strings.Join(buf[:len(buf)-1], "/")
-		gLog.Debug().Msg(m.endpoint.RawPath)
-		gLog.Debug().Msg(m.endpoint.String())
-		gLog.Debug().Msg("found group prefix " + m.groupPrefix)
+	m.authType, m.apiUser, m.apiToken = gCli.String(flagPrefix+"auth-type"), gCli.String(flagPrefix+"auth-username"), profile.Token
+	if profile.AuthType != "" {
+		m.authType = profile.AuthType
 	}
+	if profile.Username != "" {
+		m.apiUser = profile.Username
+	}
+
+	// credentials in the url userinfo are supported for compatibility only;
+	// it's "TOKEN@" form or "USERNAME:PASSWORD@" one for basic auth
+	if m.endpoint.User != nil {
+		gLog.Warn().Msg("credentials in the url leak to shell history and process list, consider --token-env or --token-file options")
 
-	m.apiToken = m.endpoint.User.Username()
+		if password, ok := m.endpoint.User.Password(); ok {
+			m.apiUser, m.apiToken = m.endpoint.User.Username(), password
+		} else {
+			m.apiToken = m.endpoint.User.Username()
+		}
+	}
 	m.endpoint.User = nil
 
+	if m.apiToken == "" {
+		user := m.apiUser
+		if e = m.resolveToken(getTokenSource(profile, flagPrefix)); e != nil {
+			return m, e
+		}
+
+		// explicitly set username has priority over netrc and credential command ones
+		if user != "" {
+			m.apiUser = user
+		}
+	}
+
+	if e = checkAPIBackend(); e != nil {
+		return m, e
+	}
+
+	// url path is a gitlab sub-path (if it's hosted under one), groups are selected with --group flags
+	gLog.Debug().Msg("using gitlab base url " + m.endpoint.String())
+
 	m.instance, e = m.setGitlabConnection()
 	return m, e
 }
@@ -66,8 +138,14 @@ func (m *glClient) setGitlabConnection() (*gitlab.Client, error) {
 			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
 		}
 	}
-	return gitlab.NewClient(m.apiToken,
+
+	m.limiter = newAPILimiter(gCli.Float64("api-rps"), gCli.Int("api-burst"))
+
+	// failed requests are retried by the job queue (see retry.go), so the client does not do it
+	options := []gitlab.ClientOptionFunc{
 		gitlab.WithBaseURL(m.endpoint.String()),
+		gitlab.WithoutRetries(),
+		gitlab.WithCustomLimiter(m.limiter),
 		gitlab.WithHTTPClient(&http.Client{
 			Timeout: gCli.Duration("http-client-timeout"),
 			Transport: m.setGitlabUserAgent(&http.Transport{
@@ -77,7 +155,43 @@ func (m *glClient) setGitlabConnection() (*gitlab.Client, error) {
 				TLSClientConfig:     tlsConfig,
 				DisableCompression:  false,
 			}),
-		}))
+		}),
+	}
+
+	gLog.Debug().Msgf("using %s auth type", m.authType)
+
+	switch m.authType {
+	case "", authTypePrivate:
+		return gitlab.NewClient(m.apiToken, options...)
+	case authTypeOAuth:
+		return gitlab.NewOAuthClient(m.apiToken, options...)
+	case authTypeJob:
+		return gitlab.NewJobClient(m.apiToken, options...)
+	case authTypeBasic:
+		if m.apiUser == "" {
+			return nil, errNoUsername
+		}
+		return gitlab.NewBasicAuthClient(m.apiUser, m.apiToken, options...)
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnknownAuthType, m.authType)
+	}
+}
+
+// getGitCredentials returns username and password for git over http
+func (m *glClient) getGitCredentials() (string, string) {
+	switch m.authType {
+	case authTypeJob:
+		return "gitlab-ci-token", m.apiToken
+	case authTypeBasic:
+		return m.apiUser, m.apiToken
+	default:
+		return "oauth2", m.apiToken
+	}
+}
+
+func (m *glClient) newGitCommand(ctx context.Context, dir string) *gitCommand {
+	username, password := m.getGitCredentials()
+	return newGitCommand(ctx, dir, username, password)
 }
 
 func (m *glClient) setGitlabUserAgent(inner http.RoundTripper) http.RoundTripper {
@@ -91,7 +205,12 @@ func (m *glClient) RoundTrip(r *http.Request) (*http.Response, error) {
 	} else {
 		r.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:99.0) Gecko/20100101 Firefox/99.0")
 	}
-	return m.inner.RoundTrip(r)
+	rsp, e := m.inner.RoundTrip(r)
+	if e == nil {
+		m.limiter.adapt(rsp)
+	}
+
+	return rsp, e
 }
 
 func (m *glClient) printGroupsAction() (e error) {
@@ -101,8 +220,16 @@ func (m *glClient) printGroupsAction() (e error) {
 		return
 	}
 
-	m.printGroups(groups)
-	return
+	var tree *groupTree
+	if tree, e = m.getInstanceGroupTreeAsync(groups); e != nil {
+		return
+	}
+
+	if e = m.printGroups(tree.getGroups()); e != nil {
+		return
+	}
+
+	return getDiscoveryError()
 }
 
 func (m *glClient) printRepositoriesAction() (e error) {
@@ -113,52 +240,145 @@ func (m *glClient) printRepositoriesAction() (e error) {
 		return
 	}
 
+	if streamer := newObjectStreamer(defaultProjectColumns); streamer != nil {
+		if e = m.streamProjects(groups, streamer); e != nil {
+			return
+		}
+
+		return getDiscoveryError()
+	}
+
 	if projects, e = m.getInstanceProjectsAsync(groups); e != nil {
 		return
 	}
 
-	m.printProjects(projects)
-	return
+	if projects, e = filterProjects(projects); e != nil {
+		return
+	}
+
+	if e = m.printProjects(projects); e != nil {
+		return
+	}
+
+	return getDiscoveryError()
+}
+
+// getDiscoveryError returns an error if the run has been cancelled or some discovery
+// jobs have been failed; found objects are printed anyway, so the output may be partial
+func getDiscoveryError() error {
+	if gCtx.Err() != nil {
+		return gCtx.Err()
+	}
+
+	if n := gFailedJobs.count(); n != 0 {
+		return fmt.Errorf("%w: %d jobs failed", errListFailed, n)
+	}
+
+	return nil
+}
+
+// streamProjects prints projects while discovery is still in progress
+func (m *glClient) streamProjects(groups []*gitlab.Group, streamer *objectStreamer) (e error) {
+	var filter *projectFilter
+	if filter, e = newProjectFilter(); e != nil {
+		return
+	}
+
+	var found, matched int
+	var errPrint error
+
+	e = m.streamInstanceProjectsAsync(groups, func(projects []*gitlab.Project) {
+		found, projects = found+len(projects), filter.apply(projects)
+		matched += len(projects)
+
+		items := make([]interface{}, len(projects))
+		for i, project := range projects {
+			items[i] = project
+		}
+
+		if err := streamer.print(items); err != nil && errPrint == nil {
+			errPrint = err
+		}
+	})
+	if e != nil {
+		return
+	}
+
+	gLog.Info().Msgf("%d of %d projects have been matched by filters", matched, found)
+	return errPrint
 }
 
 func (m *glClient) getInstanceProjectsAsync(groups []*gitlab.Group) (projects []*gitlab.Project, e error) {
-	var prjs []*gitlab.Project
-	var jobsWait sync.WaitGroup
+	e = m.streamInstanceProjectsAsync(groups, func(prjs []*gitlab.Project) {
+		projects = append(projects, prjs...)
+	})
+	return
+}
 
-	responsePool := sync.Pool{
-		New: func() interface{} {
-			return &gitlab.Response{}
-		},
+// streamInstanceProjectsAsync passes found projects to the consumer page by page as soon as
+// they are received; the consumer is never called concurrently
+func (m *glClient) streamInstanceProjectsAsync(groups []*gitlab.Group, consume func([]*gitlab.Project)) (e error) {
+	// first pages are consumed by the spawner, the rest ones by the collector
+	var mu sync.Mutex
+	emit := func(prjs []*gitlab.Project) {
+		mu.Lock()
+		defer mu.Unlock()
+		consume(prjs)
 	}
 
-	// job responses collector:
-	collector := newCollector()
-	collector.wg.Add(2)
-	go func() {
-		defer collector.wg.Done()
+	if useGraphQL() {
+		return m.streamInstanceProjectsGraphQL(groups, emit)
+	}
 
-		for _, payload := range collector.collect() {
-			result := payload.(*jobResult)
-			if result.err != nil {
-				gLog.Error().Err(result.err).Msg("")
-				continue
-			}
+	var prjs []*gitlab.Project
+
+	jobs := newJobPool(jobKindAPI, "projects-page", func(ctx context.Context, page projectsPage) ([]*gitlab.Project, error) {
+		defer gLog.Debug().Msg("all done, job can be stopped now")
 
-			projects = append(projects, result.payload.([]*gitlab.Project)...)
+		gLog.Debug().Msgf("There is new job with page %d and group %d", page.Page, page.Group)
+
+		prjs, _, e := m.getProjectsFromPage(page.Group, page.Page, gitlab.WithContext(ctx))
+		if e != nil {
+			gLog.Error().Err(e).Msg("There is abnormal result from Gitlab API")
+			return nil, e
+		}
+
+		return prjs, e
+	}, func(_ projectsPage, prjs []*gitlab.Project, err error) {
+		if err != nil {
+			gLog.Error().Err(err).Msg("")
+			return
 		}
-	}()
+
+		emit(prjs)
+	})
+	defer jobs.wait()
 
 	// job spawner:
 	for i, group := range groups {
 		gLog.Debug().Msgf("there are %d groups waiting for scaning; scan #%d", len(groups), i)
-		rsp := responsePool.Get().(*gitlab.Response)
+		rsp := &gitlab.Response{}
 
 		for nextPage := 0; nextPage <= rsp.TotalPages && gCtx.Err() == nil; nextPage++ {
 
 			// first call for totalPages variable get
 			if rsp.TotalPages == 0 {
-				if prjs, rsp, e = m.getProjectsFromPage(group.ID, rsp.NextPage); e == nil {
-					projects = append(projects, prjs...)
+				if e = withRetries(gCtx, func() (err error) {
+					prjs, rsp, err = m.getProjectsFromPage(group.ID, rsp.NextPage)
+					return
+				}); e == nil {
+					// there are no totals for collections over 10,000 items
+					if rsp.TotalPages == 0 && rsp.NextPage != 0 {
+						if prjs, e = m.getGroupProjectsSequential(group.ID); e != nil {
+							gLog.Error().Err(e).Msg("There is abnraml result from Gitlab API")
+							return
+						}
+
+						emit(prjs)
+						break
+					}
+
+					emit(prjs)
 
 					if rsp.NextPage == 0 {
 						break
@@ -174,50 +394,16 @@ func (m *glClient) getInstanceProjectsAsync(groups []*gitlab.Group) (projects []
 			}
 
 			// async calls (jobs spawn)
-			args := map[string]interface{}{
-				"page":  nextPage,
-				"group": group.ID,
-			}
-
-			jb := newJob(func(payload map[string]interface{}) (interface{}, error) {
-				defer gLog.Debug().Msg("all done, job can be stopped now")
-
-				page, group := payload["page"].(int), payload["group"].(int)
-				gLog.Debug().Msgf("There is new job with page %d and group %d", page, group)
-
-				prjs, _, e := m.getProjectsFromPage(group, page)
-				if e != nil {
-					gLog.Error().Err(e).Msg("There is abnormal result from Gitlab API")
-					return nil, e
-				}
-
-				return prjs, e
-			}, args, jobsWait.Done)
-			jb.assignCollector(collector.jobsChannel)
-
-			jobsWait.Add(1)
-			gQueue <- jb
+			jobs.spawn(projectsPage{Group: group.ID, Page: nextPage})
 		}
 
 		gLog.Debug().Msg("groups scaning was finished")
-
-		// ??
-		// in my minds it looks as getting Pooled struct
-		// and then destroy it via setting nil to pointer.
-		// So GC must clear it. Maybe it's a very bad idea.
-		rsp = nil
 	}
 
-	gLog.Debug().Msg("all jobs were spawned, waiting...")
-	jobsWait.Wait()
-
-	gLog.Debug().Msg("all jobs are executed, close collector pipeline")
-	close(collector.jobsChannel)
-	collector.wg.Wait()
 	return
 }
 
-func (m *glClient) getProjectsFromPage(gid, page int) ([]*gitlab.Project, *gitlab.Response, error) {
+func (m *glClient) getProjectsFromPage(gid, page int, options ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error) {
 	gLog.Debug().Msgf("Called with gid %d, page %d", gid, page)
 
 	listOptions := gitlab.ListOptions{}
@@ -225,41 +411,79 @@ func (m *glClient) getProjectsFromPage(gid, page int) ([]*gitlab.Project, *gitla
 		listOptions.Page = page
 	}
 
+	if hasStatisticsColumns() {
+		options = append(options, withQueryParam("statistics", "true"))
+	}
+
 	return m.instance.Groups.ListGroupProjects(gid, &gitlab.ListGroupProjectsOptions{
 		ListOptions:      listOptions,
 		IncludeSubgroups: gitlab.Bool(true),
-	})
+	}, options...)
+}
+
+// withQueryParam sets request query parameters which are not supported by gitlab lib options
+func withQueryParam(key, value string) gitlab.RequestOptionFunc {
+	return func(r *retryablehttp.Request) error {
+		query := r.URL.Query()
+		query.Set(key, value)
+		r.URL.RawQuery = query.Encode()
+		return nil
+	}
 }
 
 func (m *glClient) getInstanceGroupsAsync() (groups []*gitlab.Group, e error) {
+	if selected := gCli.StringSlice("group"); len(selected) != 0 {
+		return m.getSelectedGroups(selected)
+	} else if useGraphQL() {
+		return m.getInstanceGroupsGraphQL()
+	}
+
 	var grp []*gitlab.Group
-	var jobsWait sync.WaitGroup
 	var rsp *gitlab.Response = &gitlab.Response{}
 
-	// job responses collector:
-	collector := newCollector()
-	collector.wg.Add(2)
-	go func() {
-		defer collector.wg.Done()
-
-		for _, payload := range collector.collect() {
-			result := payload.(*jobResult)
-			if result.err != nil {
-				gLog.Error().Err(e).Msg("")
-				continue
-			}
+	jobs := newJobPool(jobKindAPI, "groups-page", func(ctx context.Context, page int) ([]*gitlab.Group, error) {
+		defer gLog.Debug().Msg("all done, job can be stopped now")
 
-			groups = append(groups, result.payload.([]*gitlab.Group)...)
+		gLog.Debug().Msgf("There is new job with page %d", page)
+
+		grps, _, e := m.getGroupsFromPage(page, gitlab.WithContext(ctx))
+		if e != nil {
+			gLog.Error().Err(e).Msg("There is abnormal result from Gitlab API")
+			return nil, e
+		}
+
+		return grps, e
+	}, func(_ int, grps []*gitlab.Group, err error) {
+		if err != nil {
+			gLog.Error().Err(err).Msg("")
+			return
 		}
-	}()
+
+		groups = append(groups, grps...)
+	})
+	defer jobs.wait()
 
 	// job spawner:
 	for nextPage := 0; nextPage <= rsp.TotalPages && gCtx.Err() == nil; nextPage++ {
 
 		// first call for totalPages variable get
 		if rsp.TotalPages == 0 {
-			if grp, rsp, e = m.getGroupsFromPage(rsp.NextPage); e == nil {
-				groups = append(groups, m.getMatchedGroups(grp)...)
+			if e = withRetries(gCtx, func() (err error) {
+				grp, rsp, err = m.getGroupsFromPage(rsp.NextPage)
+				return
+			}); e == nil {
+				// there are no totals for collections over 10,000 items
+				if rsp.TotalPages == 0 && rsp.NextPage != 0 {
+					if grp, e = m.getGroupsSequential(); e != nil {
+						gLog.Error().Err(e).Msg("There is abnraml result from Gitlab API")
+						return
+					}
+
+					groups = append(groups, grp...)
+					break
+				}
+
+				groups = append(groups, grp...)
 
 				gLog.Debug().Msgf("nextpage %d", rsp.NextPage)
 				gLog.Debug().Msgf("total pages %d", rsp.TotalPages)
@@ -276,42 +500,15 @@ func (m *glClient) getInstanceGroupsAsync() (groups []*gitlab.Group, e error) {
 		}
 
 		// async calls (jobs spawn)
-		args := map[string]interface{}{
-			"page": nextPage,
-		}
-
-		jb := newJob(func(payload map[string]interface{}) (interface{}, error) {
-			defer gLog.Debug().Msg("all done, job can be stopped now")
-
-			page := payload["page"].(int)
-			gLog.Debug().Msgf("There is new job with page %d", page)
-
-			grps, _, e := m.getGroupsFromPage(page)
-			if e != nil {
-				gLog.Error().Err(e).Msg("There is abnormal result from Gitlab API")
-				return nil, e
-			}
-
-			return m.getMatchedGroups(grps), e
-		}, args, jobsWait.Done)
-		jb.assignCollector(collector.jobsChannel)
-
-		jobsWait.Add(1)
-		gQueue <- jb
+		jobs.spawn(nextPage)
 
 		gLog.Debug().Msg("groups scaning was finished")
 	}
 
-	gLog.Debug().Msg("all jobs were spawned, waiting...")
-	jobsWait.Wait()
-
-	gLog.Debug().Msg("all jobs are executed, close collector pipeline")
-	close(collector.jobsChannel)
-	collector.wg.Wait()
 	return
 }
 
-func (m *glClient) getGroupsFromPage(page int) ([]*gitlab.Group, *gitlab.Response, error) {
+func (m *glClient) getGroupsFromPage(page int, options ...gitlab.RequestOptionFunc) ([]*gitlab.Group, *gitlab.Response, error) {
 	gLog.Debug().Msgf("Called with page %d ", page)
 
 	listOptions := gitlab.ListOptions{}
@@ -319,63 +516,72 @@ func (m *glClient) getGroupsFromPage(page int) ([]*gitlab.Group, *gitlab.Respons
 		listOptions.Page = page
 	}
 
-	listGroupOptions := &gitlab.ListGroupsOptions{
+	return m.instance.Groups.ListGroups(&gitlab.ListGroupsOptions{
 		ListOptions:  listOptions,
 		TopLevelOnly: gitlab.Bool(true),
-	}
+	}, options...)
+}
+
+// getSelectedGroups resolves --group values which may be full paths of nested groups or IDs
+func (m *glClient) getSelectedGroups(selected []string) (groups []*gitlab.Group, e error) {
+	var group *gitlab.Group
+
+	for _, gid := range selected {
+		gid = strings.Trim(gid, "/")
+		gLog.Debug().Msgf("resolving selected group %s", gid)
+
+		if e = withRetries(gCtx, func() (err error) {
+			group, _, err = m.instance.Groups.GetGroup(gid, &gitlab.GetGroupOptions{
+				WithProjects: gitlab.Bool(false),
+			}, gitlab.WithContext(gCtx))
+			return
+		}); e != nil {
+			return nil, fmt.Errorf("could not get group %s: %w", gid, e)
+		}
 
-	// ??
-	if m.groupPrefix != "" {
-		// listGroupOptions.TopLevelOnly = gitlab.Bool(false)
-		listGroupOptions.AllAvailable = gitlab.Bool(true)
+		groups = append(groups, group)
 	}
 
-	return m.instance.Groups.ListGroups(listGroupOptions)
+	return getOutermostGroups(groups), nil
 }
 
-func (m *glClient) getMatchedGroups(groups []*gitlab.Group) (matchedGroups []*gitlab.Group) {
-	if m.groupPrefix == "" {
-		return groups
-	}
-
+// getOutermostGroups drops duplicates and groups nested into other given ones,
+// because projects and descendants are always listed with subgroups
+func getOutermostGroups(groups []*gitlab.Group) (outermost []*gitlab.Group) {
+LOOP:
 	for i, group := range groups {
-		if group.FullPath == m.groupPrefix {
-			matchedGroups = append(matchedGroups, group)
-			continue
+		for j, parent := range groups {
+			if strings.HasPrefix(group.FullPath, parent.FullPath+"/") || (group.ID == parent.ID && j < i) {
+				continue LOOP
+			}
 		}
 
-		groups[i] = nil
+		outermost = append(outermost, group)
 	}
 
 	return
 }
 
-func (m *glClient) printGroups(groups []*gitlab.Group) {
-	t := table.NewWriter()
-	defer t.Render()
-
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"ID", "Path", "Name", "Visibility", "Parent ID", "Created At"})
+func (m *glClient) printGroups(groups []*gitlab.Group) error {
+	items := make([]interface{}, 0, len(groups))
 
 	for _, group := range groups {
 		if group == nil {
 			continue
 		}
 
-		t.AppendRow([]interface{}{group.ID, group.FullPath, group.FullName, group.Visibility, group.ParentID, group.CreatedAt})
+		items = append(items, group)
 	}
-}
 
-func (m *glClient) printProjects(projects []*gitlab.Project) {
-	t := table.NewWriter()
-	defer t.Render()
+	return printObjects(items, defaultGroupColumns)
+}
 
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"ID", "Path", "Name", "Visibility", "Created At", "Last Activity"})
+func (m *glClient) printProjects(projects []*gitlab.Project) error {
+	items := make([]interface{}, len(projects))
 
-	for _, project := range projects {
-		t.AppendRow([]interface{}{
-			project.ID, project.PathWithNamespace, project.Name, project.Visibility, project.CreatedAt, project.LastActivityAt,
-		})
+	for i, project := range projects {
+		items[i] = project
 	}
+
+	return printObjects(items, defaultProjectColumns)
 }
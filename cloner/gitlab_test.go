@@ -0,0 +1,34 @@
+package cloner
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGetDiscoveryError(t *testing.T) {
+	startTestQueues(t, 0)
+
+	if e := getDiscoveryError(); e != nil {
+		t.Fatalf("got %v before discovery, want no error", e)
+	}
+
+	jobs := newJobPool(jobKindAPI, "test", func(ctx context.Context, _ int) (int, error) {
+		return 0, errors.New("403 forbidden")
+	}, func(_, _ int, _ error) {})
+
+	waitTimeout(t, func() {
+		jobs.spawn(0)
+		jobs.wait()
+	})
+
+	if e := getDiscoveryError(); !errors.Is(e, errListFailed) {
+		t.Errorf("got %v after the failed job, want list error", e)
+	}
+
+	gAbort()
+
+	if e := getDiscoveryError(); !errors.Is(e, context.Canceled) {
+		t.Errorf("got %v after the cancellation, want cancellation error", e)
+	}
+}
@@ -0,0 +1,387 @@
+package cloner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/xanzy/go-gitlab"
+)
+
+const (
+	apiBackendREST    = "rest"
+	apiBackendGraphQL = "graphql"
+)
+
+var (
+	errUnknownAPIBackend = errors.New("unknown api backend")
+	errGraphQL           = errors.New("graphql query has been failed")
+)
+
+// graphql queries fetch up to 100 nodes per request (the api maximum)
+const (
+	gqlGroupFields = `id name path fullName fullPath description visibility webUrl createdAt parent { id }`
+
+	gqlGroupsQuery = `query($after: String) {
+  groups(first: 100, after: $after) {
+    nodes { ` + gqlGroupFields + ` }
+    pageInfo { hasNextPage endCursor }
+  }
+}`
+	gqlDescendantGroupsQuery = `query($path: ID!, $after: String) {
+  group(fullPath: $path) {
+    descendantGroups(first: 100, after: $after) {
+      nodes { ` + gqlGroupFields + ` }
+      pageInfo { hasNextPage endCursor }
+    }
+  }
+}`
+	gqlGroupProjectsQuery = `query($path: ID!, $after: String) {
+  group(fullPath: $path) {
+    projects(includeSubgroups: true, first: 100, after: $after) {
+      nodes {
+        id name path fullPath nameWithNamespace description visibility archived topics
+        createdAt lastActivityAt webUrl httpUrlToRepo sshUrlToRepo
+        namespace { id name path fullPath }
+        repository { rootRef }
+        statistics { storageSize repositorySize lfsObjectsSize buildArtifactsSize commitCount }
+      }
+      pageInfo { hasNextPage endCursor }
+    }
+  }
+}`
+)
+
+type (
+	gqlResponse struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	gqlPageInfo struct {
+		HasNextPage bool   `json:"hasNextPage"`
+		EndCursor   string `json:"endCursor"`
+	}
+	gqlNamespace struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Path     string `json:"path"`
+		FullPath string `json:"fullPath"`
+	}
+	gqlGroup struct {
+		gqlNamespace
+		FullName    string     `json:"fullName"`
+		Description string     `json:"description"`
+		Visibility  string     `json:"visibility"`
+		WebURL      string     `json:"webUrl"`
+		CreatedAt   *time.Time `json:"createdAt"`
+		Parent      *struct {
+			ID string `json:"id"`
+		} `json:"parent"`
+	}
+	gqlGroupConnection struct {
+		Nodes    []*gqlGroup `json:"nodes"`
+		PageInfo gqlPageInfo `json:"pageInfo"`
+	}
+	gqlProject struct {
+		ID                string        `json:"id"`
+		Name              string        `json:"name"`
+		Path              string        `json:"path"`
+		FullPath          string        `json:"fullPath"`
+		NameWithNamespace string        `json:"nameWithNamespace"`
+		Description       string        `json:"description"`
+		Visibility        string        `json:"visibility"`
+		Archived          bool          `json:"archived"`
+		Topics            []string      `json:"topics"`
+		CreatedAt         *time.Time    `json:"createdAt"`
+		LastActivityAt    *time.Time    `json:"lastActivityAt"`
+		WebURL            string        `json:"webUrl"`
+		HTTPURLToRepo     string        `json:"httpUrlToRepo"`
+		SSHURLToRepo      string        `json:"sshUrlToRepo"`
+		Namespace         *gqlNamespace `json:"namespace"`
+		Repository        *struct {
+			RootRef string `json:"rootRef"`
+		} `json:"repository"`
+		Statistics *struct {
+			StorageSize        float64 `json:"storageSize"`
+			RepositorySize     float64 `json:"repositorySize"`
+			LfsObjectsSize     float64 `json:"lfsObjectsSize"`
+			BuildArtifactsSize float64 `json:"buildArtifactsSize"`
+			CommitCount        float64 `json:"commitCount"`
+		} `json:"statistics"`
+	}
+	gqlProjectConnection struct {
+		Nodes    []*gqlProject `json:"nodes"`
+		PageInfo gqlPageInfo   `json:"pageInfo"`
+	}
+)
+
+func useGraphQL() bool {
+	return gCli.String("api-backend") == apiBackendGraphQL
+}
+
+func checkAPIBackend() error {
+	switch backend := gCli.String("api-backend"); backend {
+	case apiBackendREST, apiBackendGraphQL:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", errUnknownAPIBackend, backend)
+	}
+}
+
+// queryGraphQL posts the query to the graphql endpoint (it's located near the rest api one)
+// and decodes response data into v
+func (m *glClient) queryGraphQL(ctx context.Context, query string, variables map[string]interface{}, v interface{}) error {
+	body := map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	}
+
+	options := []gitlab.RequestOptionFunc{
+		gitlab.WithContext(ctx),
+		func(r *retryablehttp.Request) error {
+			r.URL.Path, r.URL.RawPath = path.Join(path.Dir(strings.TrimSuffix(m.instance.BaseURL().Path, "/")), "graphql"), ""
+			return nil
+		},
+	}
+
+	// the graphql api accepts personal access tokens as bearer ones only
+	if m.authType == "" || m.authType == authTypePrivate {
+		options = append(options, func(r *retryablehttp.Request) error {
+			r.Header.Set("Authorization", "Bearer "+m.apiToken)
+			return nil
+		})
+	}
+
+	req, e := m.instance.NewRequest(http.MethodPost, "graphql", body, options)
+	if e != nil {
+		return e
+	}
+
+	rsp := &gqlResponse{}
+	if _, e = m.instance.Do(req, rsp); e != nil {
+		return e
+	}
+
+	if len(rsp.Errors) != 0 {
+		messages := make([]string, len(rsp.Errors))
+		for i, err := range rsp.Errors {
+			messages[i] = err.Message
+		}
+		return fmt.Errorf("%w: %s", errGraphQL, strings.Join(messages, "; "))
+	}
+
+	return json.Unmarshal(rsp.Data, v)
+}
+
+// walkGraphQL requests all pages of the query; fn returns the connection page info
+func (m *glClient) walkGraphQL(ctx context.Context, query string, variables map[string]interface{}, fn func(data json.RawMessage) (*gqlPageInfo, error)) error {
+	variables["after"] = nil
+
+	for ctx.Err() == nil {
+		var data json.RawMessage
+		if e := m.queryGraphQL(ctx, query, variables, &data); e != nil {
+			return e
+		}
+
+		info, e := fn(data)
+		if e != nil {
+			return e
+		} else if info == nil || !info.HasNextPage {
+			return nil
+		}
+
+		variables["after"] = info.EndCursor
+	}
+
+	return ctx.Err()
+}
+
+// getInstanceGroupsGraphQL returns top-level groups (the rest ones are included by projects
+// and descendants queries); it's called outside of the queue, so failed walks are restarted
+func (m *glClient) getInstanceGroupsGraphQL() (groups []*gitlab.Group, e error) {
+	e = withRetries(gCtx, func() error {
+		groups = nil
+
+		return m.walkGraphQL(gCtx, gqlGroupsQuery, map[string]interface{}{}, func(raw json.RawMessage) (*gqlPageInfo, error) {
+			var data struct {
+				Groups gqlGroupConnection `json:"groups"`
+			}
+			if e := json.Unmarshal(raw, &data); e != nil {
+				return nil, e
+			}
+
+			for _, node := range data.Groups.Nodes {
+				if node.Parent == nil {
+					groups = append(groups, node.toGroup())
+				}
+			}
+
+			return &data.Groups.PageInfo, nil
+		})
+	})
+
+	return
+}
+
+func (m *glClient) getDescendantGroupsGraphQL(ctx context.Context, fullPath string) (groups []*gitlab.Group, e error) {
+	variables := map[string]interface{}{"path": fullPath}
+
+	e = m.walkGraphQL(ctx, gqlDescendantGroupsQuery, variables, func(raw json.RawMessage) (*gqlPageInfo, error) {
+		var data struct {
+			Group *struct {
+				DescendantGroups gqlGroupConnection `json:"descendantGroups"`
+			} `json:"group"`
+		}
+		if e := json.Unmarshal(raw, &data); e != nil {
+			return nil, e
+		} else if data.Group == nil {
+			return nil, fmt.Errorf("%w: there is no group %s", errGraphQL, fullPath)
+		}
+
+		for _, node := range data.Group.DescendantGroups.Nodes {
+			groups = append(groups, node.toGroup())
+		}
+
+		return &data.Group.DescendantGroups.PageInfo, nil
+	})
+
+	return
+}
+
+func (m *glClient) getGroupProjectsGraphQL(ctx context.Context, fullPath string) (projects []*gitlab.Project, e error) {
+	variables := map[string]interface{}{"path": fullPath}
+
+	e = m.walkGraphQL(ctx, gqlGroupProjectsQuery, variables, func(raw json.RawMessage) (*gqlPageInfo, error) {
+		var data struct {
+			Group *struct {
+				Projects gqlProjectConnection `json:"projects"`
+			} `json:"group"`
+		}
+		if e := json.Unmarshal(raw, &data); e != nil {
+			return nil, e
+		} else if data.Group == nil {
+			return nil, fmt.Errorf("%w: there is no group %s", errGraphQL, fullPath)
+		}
+
+		for _, node := range data.Group.Projects.Nodes {
+			projects = append(projects, node.toProject())
+		}
+
+		return &data.Group.Projects.PageInfo, nil
+	})
+
+	return
+}
+
+// streamInstanceProjectsGraphQL spawns a job per group, every job walks all pages of group projects
+func (m *glClient) streamInstanceProjectsGraphQL(groups []*gitlab.Group, consume func([]*gitlab.Project)) (e error) {
+	jobs := newJobPool(jobKindAPI, "graphql-projects", func(ctx context.Context, fullPath string) ([]*gitlab.Project, error) {
+		defer gLog.Debug().Msg("all done, job can be stopped now")
+
+		gLog.Debug().Msgf("There is new graphql job for projects of group %s", fullPath)
+		return m.getGroupProjectsGraphQL(ctx, fullPath)
+	}, func(_ string, projects []*gitlab.Project, err error) {
+		if err != nil {
+			gLog.Error().Err(err).Msg("")
+			return
+		}
+
+		consume(projects)
+	})
+
+	// job spawner:
+	for _, group := range groups {
+		if group == nil || gCtx.Err() != nil {
+			continue
+		}
+
+		jobs.spawn(group.FullPath)
+	}
+
+	jobs.wait()
+	return
+}
+
+// parseGlobalID returns the numeric id of "gid://gitlab/Type/ID" graphql ids
+func parseGlobalID(gid string) int {
+	id, _ := strconv.Atoi(gid[strings.LastIndex(gid, "/")+1:])
+	return id
+}
+
+func (m *gqlGroup) toGroup() *gitlab.Group {
+	group := &gitlab.Group{
+		ID:          parseGlobalID(m.ID),
+		Name:        m.Name,
+		Path:        m.Path,
+		FullName:    m.FullName,
+		FullPath:    m.FullPath,
+		Description: m.Description,
+		Visibility:  gitlab.VisibilityValue(m.Visibility),
+		WebURL:      m.WebURL,
+		CreatedAt:   m.CreatedAt,
+	}
+
+	if m.Parent != nil {
+		group.ParentID = parseGlobalID(m.Parent.ID)
+	}
+
+	return group
+}
+
+// toProject converts the graphql node to the rest api model; fork relations are not
+// available in graphql, so forks filter is rejected with this backend (see newProjectFilter)
+func (m *gqlProject) toProject() *gitlab.Project {
+	project := &gitlab.Project{
+		ID:                parseGlobalID(m.ID),
+		Name:              m.Name,
+		Path:              m.Path,
+		PathWithNamespace: m.FullPath,
+		NameWithNamespace: m.NameWithNamespace,
+		Description:       m.Description,
+		Visibility:        gitlab.VisibilityValue(m.Visibility),
+		Archived:          m.Archived,
+		Topics:            m.Topics,
+		CreatedAt:         m.CreatedAt,
+		LastActivityAt:    m.LastActivityAt,
+		WebURL:            m.WebURL,
+		HTTPURLToRepo:     m.HTTPURLToRepo,
+		SSHURLToRepo:      m.SSHURLToRepo,
+	}
+
+	if m.Namespace != nil {
+		project.Namespace = &gitlab.ProjectNamespace{
+			ID:       parseGlobalID(m.Namespace.ID),
+			Name:     m.Namespace.Name,
+			Path:     m.Namespace.Path,
+			FullPath: m.Namespace.FullPath,
+			Kind:     "group",
+		}
+	}
+
+	if m.Repository != nil {
+		project.DefaultBranch = m.Repository.RootRef
+	}
+
+	if m.Statistics != nil {
+		project.Statistics = &gitlab.ProjectStatistics{
+			StorageStatistics: gitlab.StorageStatistics{
+				StorageSize:      int64(m.Statistics.StorageSize),
+				RepositorySize:   int64(m.Statistics.RepositorySize),
+				LfsObjectsSize:   int64(m.Statistics.LfsObjectsSize),
+				JobArtifactsSize: int64(m.Statistics.BuildArtifactsSize),
+			},
+			CommitCount: int(m.Statistics.CommitCount),
+		}
+	}
+
+	return project
+}
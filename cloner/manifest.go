@@ -0,0 +1,138 @@
+package cloner
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
+)
+
+var errInvalidManifest = errors.New("invalid manifest")
+
+type (
+	manifestRules struct {
+		Groups   []string `yaml:"groups"`
+		Projects []string `yaml:"projects"`
+		IDs      []int    `yaml:"ids"`
+
+		// plain text manifest entries which may be either group or project paths
+		paths []string
+	}
+	manifest struct {
+		Include manifestRules `yaml:"include"`
+		Exclude manifestRules `yaml:"exclude"`
+	}
+)
+
+// loadManifest reads the sync scope file. YAML manifests (*.yaml, *.yml) have include and
+// exclude sections with groups, projects and ids lists. Plain text manifests have an entry
+// per line: project ID or group/project path glob, "!" prefix excludes, "#" starts a comment
+func loadManifest(filename string) (*manifest, error) {
+	buf, e := os.ReadFile(filename)
+	if e != nil {
+		return nil, e
+	}
+
+	mnf := &manifest{}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		if e = yaml.Unmarshal(buf, mnf); e != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidManifest, e)
+		}
+	default:
+		mnf.parseText(buf)
+	}
+
+	for _, rules := range []*manifestRules{&mnf.Include, &mnf.Exclude} {
+		for _, pattern := range append(append(rules.Groups, rules.Projects...), rules.paths...) {
+			if _, e = path.Match(pattern, ""); e != nil {
+				return nil, fmt.Errorf("%w: pattern %s: %v", errInvalidManifest, pattern, e)
+			}
+		}
+	}
+
+	gLog.Debug().Msgf("manifest %s has been loaded", filename)
+	return mnf, nil
+}
+
+func (m *manifest) parseText(buf []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+
+		rules := &m.Include
+		if strings.HasPrefix(line, "!") {
+			rules, line = &m.Exclude, strings.TrimSpace(line[1:])
+		}
+
+		if id, e := strconv.Atoi(line); e == nil {
+			rules.IDs = append(rules.IDs, id)
+			continue
+		}
+
+		rules.paths = append(rules.paths, strings.Trim(line, "/"))
+	}
+}
+
+// match returns false and the reason if the project is out of the manifest scope
+func (m *manifest) match(project *gitlab.Project) (string, bool) {
+	if !m.Include.isEmpty() && !m.Include.match(project) {
+		return "project is not included by manifest", false
+	}
+
+	if m.Exclude.match(project) {
+		return "project is excluded by manifest", false
+	}
+
+	return "", true
+}
+
+func (m *manifestRules) isEmpty() bool {
+	return len(m.Groups) == 0 && len(m.Projects) == 0 && len(m.IDs) == 0 && len(m.paths) == 0
+}
+
+func (m *manifestRules) match(project *gitlab.Project) bool {
+	for _, id := range m.IDs {
+		if project.ID == id {
+			return true
+		}
+	}
+
+	for _, pattern := range append(m.Projects, m.paths...) {
+		if ok, _ := path.Match(pattern, project.PathWithNamespace); ok {
+			return true
+		}
+	}
+
+	if project.Namespace == nil {
+		return false
+	}
+
+	// group patterns match projects of the group and all its subgroups
+	for _, pattern := range append(m.Groups, m.paths...) {
+		for namespace := project.Namespace.FullPath; namespace != "." && namespace != ""; namespace = path.Dir(namespace) {
+			if ok, _ := path.Match(pattern, namespace); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
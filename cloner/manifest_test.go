@@ -0,0 +1,74 @@
+package cloner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestManifestParseText(t *testing.T) {
+	mnf := &manifest{}
+	mnf.parseText([]byte(`# sync scope
+42
+platform/      # trailing slashes are trimmed
+/tools/*/cli
+
+!platform/legacy
+! 13
+!platform/*/sandbox-*
+`))
+
+	want := &manifest{
+		Include: manifestRules{IDs: []int{42}, paths: []string{"platform", "tools/*/cli"}},
+		Exclude: manifestRules{IDs: []int{13}, paths: []string{"platform/legacy", "platform/*/sandbox-*"}},
+	}
+
+	if !reflect.DeepEqual(mnf, want) {
+		t.Errorf("got %+v, want %+v", mnf, want)
+	}
+}
+
+func TestManifestMatch(t *testing.T) {
+	newProject := func(id int, namespace, path string) *gitlab.Project {
+		return &gitlab.Project{
+			ID:                id,
+			PathWithNamespace: namespace + "/" + path,
+			Namespace:         &gitlab.ProjectNamespace{FullPath: namespace},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		manifest string
+		project  *gitlab.Project
+		want     bool
+	}{
+		{"empty manifest", "", newProject(1, "a", "p"), true},
+		{"included by id", "42", newProject(42, "a", "p"), true},
+		{"not included by id", "42", newProject(1, "a", "p"), false},
+		{"included by project path", "a/p", newProject(1, "a", "p"), true},
+		{"included by group", "a", newProject(1, "a/b/c", "p"), true},
+		{"group prefix is not a group", "a", newProject(1, "ab", "p"), false},
+		{"project glob", "a/*", newProject(1, "a", "p"), true},
+		{"nested group glob", "a/*/c", newProject(1, "a/b/c/d", "p"), true},
+		{"nested group glob mismatch", "a/*/c", newProject(1, "a/c", "p"), false},
+		{"excluded only", "!a/legacy", newProject(1, "a/legacy", "p"), false},
+		{"not excluded only", "!a/legacy", newProject(1, "a", "p"), true},
+		{"exclude has priority", "a\n!a/*/sandbox-*", newProject(1, "a/b", "sandbox-1"), false},
+		{"exclude glob mismatch", "a\n!a/*/sandbox-*", newProject(1, "a/b", "prod"), true},
+		{"excluded by id", "a\n!7", newProject(7, "a", "p"), false},
+		{"user namespace", "a", &gitlab.Project{ID: 1, PathWithNamespace: "user/p"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mnf := &manifest{}
+			mnf.parseText([]byte(tt.manifest))
+
+			if reason, ok := mnf.match(tt.project); ok != tt.want {
+				t.Errorf("got %v (%s), want %v", ok, reason, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package cloner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+var errUserNamespace = errors.New("user namespace is not found on the destination instance")
+
+type migrator struct {
+	source      *glClient
+	destination *glClient
+
+	// destination namespace IDs cache, key is the namespace full path
+	namespaces map[string]int
+	mu         sync.Mutex
+}
+
+func newMigrator(source, destination *glClient) *migrator {
+	return &migrator{
+		source:      source,
+		destination: destination,
+
+		namespaces: make(map[string]int),
+	}
+}
+
+func (m *migrator) migrateAction() (e error) {
+	var groups []*gitlab.Group
+	var projects []*gitlab.Project
+
+	if groups, e = m.source.getInstanceGroupsAsync(); e != nil {
+		return
+	}
+
+	var tree *groupTree
+	if tree, e = m.source.getInstanceGroupTreeAsync(groups); e != nil {
+		return
+	}
+
+	if projects, e = m.source.getInstanceProjectsAsync(groups); e != nil {
+		return
+	}
+
+	if projects, e = filterProjects(projects); e != nil {
+		return
+	}
+
+	// groups without selected projects are not created on the destination
+	tree = tree.prune(projects)
+
+	targetDir := gCli.String("target-dir")
+	if gCli.Bool("dry-run") {
+		return m.planMigrate(targetDir, tree, projects)
+	}
+
+	if e = m.createDestinationGroupTree(tree); e != nil {
+		return
+	}
+
+	if e = os.MkdirAll(targetDir, 0755); e != nil {
+		return
+	}
+
+	return runProjectJobsAsync("migrate", targetDir, true, projects, m.migrateProject)
+}
+
+func (m *migrator) migrateProject(ctx context.Context, project *gitlab.Project, path string) (e error) {
+	if e = m.source.cloneProject(ctx, project, path, true); e != nil {
+		return
+	}
+
+	var nid int
+	if nid, e = m.getDestinationNamespace(project.Namespace); e != nil {
+		return
+	}
+
+	var dstProject *gitlab.Project
+	if dstProject, e = m.getDestinationProject(ctx, project, nid); e != nil {
+		return
+	}
+
+	if e = m.destination.newGitCommand(ctx, path).push(dstProject.HTTPURLToRepo); e != nil {
+		return fmt.Errorf("could not push %s: %w", project.PathWithNamespace, e)
+	}
+
+	// gitlab picks the first pushed branch as the default one
+	if project.DefaultBranch != "" && project.DefaultBranch != dstProject.DefaultBranch {
+		if _, _, e = m.destination.instance.Projects.EditProject(dstProject.ID, &gitlab.EditProjectOptions{
+			DefaultBranch: gitlab.String(project.DefaultBranch),
+		}, gitlab.WithContext(ctx)); e != nil {
+			return fmt.Errorf("could not set default branch of %s: %w", project.PathWithNamespace, e)
+		}
+	}
+
+	gLog.Info().Msgf("project %s has been migrated", project.PathWithNamespace)
+	return
+}
+
+// createDestinationGroupTree recreates the source group tree on the destination instance
+// in the parent-first order; existing groups are left untouched. Groups are created outside
+// of the queue, so they are retried here
+func (m *migrator) createDestinationGroupTree(tree *groupTree) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return tree.walk(func(node *groupNode) error {
+		if gCtx.Err() != nil {
+			return gCtx.Err()
+		}
+
+		return withRetries(gCtx, func() error {
+			_, e := m.getDestinationGroup(node.group.FullPath, node.group)
+			return e
+		})
+	})
+}
+
+// getDestinationNamespace returns ID of the destination namespace with the same full path
+func (m *migrator) getDestinationNamespace(namespace *gitlab.ProjectNamespace) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if namespace.Kind != "user" {
+		return m.getDestinationGroup(namespace.FullPath, nil)
+	}
+
+	if nid, ok := m.namespaces[namespace.FullPath]; ok {
+		return nid, nil
+	}
+
+	ns, rsp, e := m.destination.instance.Namespaces.GetNamespace(namespace.FullPath)
+	if e != nil {
+		if rsp != nil && rsp.StatusCode == http.StatusNotFound {
+			return 0, fmt.Errorf("%w: %s", errUserNamespace, namespace.FullPath)
+		}
+		return 0, e
+	}
+
+	m.namespaces[namespace.FullPath] = ns.ID
+	return ns.ID, nil
+}
+
+// getDestinationGroup returns ID of the destination group with the given full path and
+// creates it with all missing parents if needed; the source group (if known) provides
+// name, description and visibility for the new one. Caller must hold m.mu
+func (m *migrator) getDestinationGroup(fullPath string, source *gitlab.Group) (int, error) {
+	if nid, ok := m.namespaces[fullPath]; ok {
+		return nid, nil
+	}
+
+	ns, rsp, e := m.destination.instance.Namespaces.GetNamespace(fullPath)
+	if e == nil {
+		m.namespaces[fullPath] = ns.ID
+		return ns.ID, nil
+	} else if rsp == nil || rsp.StatusCode != http.StatusNotFound {
+		return 0, e
+	}
+
+	opts := &gitlab.CreateGroupOptions{
+		Name: gitlab.String(path.Base(fullPath)),
+		Path: gitlab.String(path.Base(fullPath)),
+	}
+
+	if source != nil {
+		opts.Name = gitlab.String(source.Name)
+		opts.Path = gitlab.String(source.Path)
+		opts.Description = gitlab.String(source.Description)
+		opts.Visibility = gitlab.Visibility(source.Visibility)
+	}
+
+	if parent := path.Dir(fullPath); parent != "." {
+		var pid int
+		if pid, e = m.getDestinationGroup(parent, nil); e != nil {
+			return 0, e
+		}
+		opts.ParentID = gitlab.Int(pid)
+	}
+
+	grp, _, e := m.destination.instance.Groups.CreateGroup(opts)
+	if e != nil {
+		return 0, fmt.Errorf("could not create group %s: %w", fullPath, e)
+	}
+
+	gLog.Info().Msgf("group %s has been created on the destination instance", fullPath)
+	m.namespaces[fullPath] = grp.ID
+	return grp.ID, nil
+}
+
+func (m *migrator) getDestinationProject(ctx context.Context, project *gitlab.Project, nid int) (*gitlab.Project, error) {
+	dstProject, rsp, e := m.destination.instance.Projects.GetProject(project.PathWithNamespace, nil, gitlab.WithContext(ctx))
+	if e == nil {
+		return dstProject, nil
+	} else if rsp == nil || rsp.StatusCode != http.StatusNotFound {
+		return nil, e
+	}
+
+	if dstProject, _, e = m.destination.instance.Projects.CreateProject(&gitlab.CreateProjectOptions{
+		Name:        gitlab.String(project.Name),
+		Path:        gitlab.String(project.Path),
+		NamespaceID: gitlab.Int(nid),
+		Description: gitlab.String(project.Description),
+		Visibility:  gitlab.Visibility(project.Visibility),
+	}, gitlab.WithContext(ctx)); e != nil {
+		return nil, fmt.Errorf("could not create project %s: %w", project.PathWithNamespace, e)
+	}
+
+	gLog.Info().Msgf("project %s has been created on the destination instance", project.PathWithNamespace)
+	return dstProject, nil
+}
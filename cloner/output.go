@@ -0,0 +1,130 @@
+package cloner
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputFormatTable    = "table"
+	outputFormatJSON     = "json"
+	outputFormatYAML     = "yaml"
+	outputFormatCSV      = "csv"
+	outputFormatTSV      = "tsv"
+	outputFormatMarkdown = "markdown"
+	outputFormatHTML     = "html"
+)
+
+var errUnknownOutputFormat = errors.New("unknown output format")
+
+// printOutput renders rows in the format chosen by --output flag;
+// json and yaml formats dump the raw gitlab objects instead of rows
+func printOutput(raw interface{}, header table.Row, rows []table.Row) error {
+	return writeOutput(os.Stdout, gCli.String("output"), raw, header, rows)
+}
+
+func writeOutput(w io.Writer, format string, raw interface{}, header table.Row, rows []table.Row) error {
+	switch format {
+	case outputFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(raw)
+	case outputFormatYAML:
+		return writeYAML(w, raw)
+	case outputFormatCSV:
+		return writeCSV(w, ',', header, rows)
+	case outputFormatTSV:
+		return writeCSV(w, '\t', header, rows)
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	t.AppendHeader(header)
+	t.AppendRows(rows)
+
+	switch format {
+	case "", outputFormatTable:
+		t.Render()
+	case outputFormatMarkdown:
+		t.RenderMarkdown()
+	case outputFormatHTML:
+		t.RenderHTML()
+	default:
+		return fmt.Errorf("%w: %s", errUnknownOutputFormat, format)
+	}
+
+	return nil
+}
+
+// gitlab structs have json tags only, so yaml keys are taken from the json representation
+func writeYAML(w io.Writer, raw interface{}) error {
+	buf, e := json.Marshal(raw)
+	if e != nil {
+		return e
+	}
+
+	var generic interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if e = dec.Decode(&generic); e != nil {
+		return e
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+
+	return enc.Encode(normalizeNumbers(generic))
+}
+
+// normalizeNumbers replaces json.Number values with integers (or floats) to avoid
+// both exponent notation of big IDs and quoting of numbers in yaml output
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, e := v.Int64(); e == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = normalizeNumbers(v[key])
+		}
+	}
+	return value
+}
+
+// writeCSV writes rfc 4180 records (go-pretty escapes commas and quotes with backslashes,
+// which is not understood by spreadsheets)
+func writeCSV(w io.Writer, comma rune, header table.Row, rows []table.Row) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+
+	for _, row := range append([]table.Row{header}, rows...) {
+		record := make([]string, len(row))
+		for i, cell := range row {
+			record[i] = fmt.Sprint(cell)
+		}
+
+		if e := writer.Write(record); e != nil {
+			return e
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
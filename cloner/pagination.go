@@ -0,0 +1,100 @@
+package cloner
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/xanzy/go-gitlab"
+)
+
+// getNextLink returns the rel="next" url of the Link response header
+func getNextLink(rsp *gitlab.Response) string {
+	for _, link := range strings.Split(rsp.Header.Get("Link"), ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			}
+		}
+	}
+
+	return ""
+}
+
+// withNextLink replaces request query parameters with ones of the Link header url
+// (keyset cursor and all options of the first request)
+func withNextLink(link string) gitlab.RequestOptionFunc {
+	return func(r *retryablehttp.Request) error {
+		next, e := url.Parse(link)
+		if e != nil {
+			return e
+		}
+
+		r.URL.RawQuery = next.RawQuery
+		return nil
+	}
+}
+
+// walkPages requests all pages one by one and is used when offset pagination has no totals
+// (gitlab omits them for collections over 10,000 items); keyset pagination is tried first,
+// pages are walked by X-Next-Page if it's not supported by the instance or the resource.
+// Pages are requested outside of the queue, so they are retried here
+func walkPages(keyset []gitlab.RequestOptionFunc, fetchPage func(page int, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error)) error {
+	fetch := func(page int, options ...gitlab.RequestOptionFunc) (rsp *gitlab.Response, e error) {
+		e = withRetries(gCtx, func() (err error) {
+			rsp, err = fetchPage(page, append(options, gitlab.WithContext(gCtx))...)
+			return
+		})
+		return
+	}
+
+	rsp, e := fetch(0, append(keyset, withQueryParam("pagination", "keyset"))...)
+	if e == nil {
+		for link := getNextLink(rsp); link != "" && gCtx.Err() == nil; link = getNextLink(rsp) {
+			if rsp, e = fetch(0, withNextLink(link)); e != nil {
+				return e
+			}
+		}
+
+		return nil
+	}
+
+	gLog.Debug().Err(e).Msg("keyset pagination is not supported, walking pages one by one")
+
+	for page := 1; page != 0 && gCtx.Err() == nil; page = rsp.NextPage {
+		if rsp, e = fetch(page); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func (m *glClient) getGroupProjectsSequential(gid int) (projects []*gitlab.Project, e error) {
+	keyset := []gitlab.RequestOptionFunc{withQueryParam("order_by", "id"), withQueryParam("sort", "asc")}
+
+	e = walkPages(keyset, func(page int, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+		prjs, rsp, e := m.getProjectsFromPage(gid, page, options...)
+		projects = append(projects, prjs...)
+		return rsp, e
+	})
+
+	return
+}
+
+func (m *glClient) getGroupsSequential() (groups []*gitlab.Group, e error) {
+	keyset := []gitlab.RequestOptionFunc{withQueryParam("order_by", "name"), withQueryParam("sort", "asc")}
+
+	e = walkPages(keyset, func(page int, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+		grps, rsp, e := m.getGroupsFromPage(page, options...)
+		groups = append(groups, grps...)
+		return rsp, e
+	})
+
+	return
+}
@@ -0,0 +1,39 @@
+package cloner
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestGetNextLink(t *testing.T) {
+	const next = "https://gitlab.example.com/api/v4/groups/1/projects?id_after=42&pagination=keyset&per_page=100"
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"no header", "", ""},
+		{"next only", `<` + next + `>; rel="next"`, next},
+		{"next among others", `<https://gitlab.example.com/first>; rel="first", <` + next + `>; rel="next", <https://gitlab.example.com/last>; rel="last"`, next},
+		{"no next relation", `<https://gitlab.example.com/first>; rel="first", <https://gitlab.example.com/prev>; rel="prev"`, ""},
+		{"next is not a prefix", `<https://gitlab.example.com/next-page>; rel="nextpage"`, ""},
+		{"extra parameters", `<` + next + `>; type="application/json"; rel="next"`, next},
+		{"no parameters", `<` + next + `>`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rsp := &gitlab.Response{Response: &http.Response{Header: http.Header{}}}
+			if tt.header != "" {
+				rsp.Header.Set("Link", tt.header)
+			}
+
+			if got := getNextLink(rsp); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
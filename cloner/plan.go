@@ -0,0 +1,158 @@
+package cloner
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/xanzy/go-gitlab"
+)
+
+const (
+	planActionClone     = "clone"
+	planActionFetch     = "fetch"
+	planActionSkip      = "skip"
+	planActionCreate    = "create"
+	planActionPush      = "push"
+	planActionUntouched = "untouched"
+	planActionFail      = "fail"
+)
+
+type (
+	planItem struct {
+		kind   string
+		path   string
+		action string
+		reason string
+	}
+	plan struct {
+		items []*planItem
+		mu    sync.Mutex
+	}
+)
+
+func newPlan() *plan {
+	return &plan{}
+}
+
+func (m *plan) add(kind, path, action, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items = append(m.items, &planItem{kind: kind, path: path, action: action, reason: reason})
+}
+
+func (m *plan) print() {
+	t := table.NewWriter()
+	defer t.Render()
+
+	// items are added by async jobs, so keep output order predictable;
+	// groups go first as they are created before projects
+	sort.SliceStable(m.items, func(i, j int) bool {
+		if m.items[i].kind != m.items[j].kind {
+			return m.items[i].kind == "group"
+		}
+		return m.items[i].path < m.items[j].path
+	})
+
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Type", "Path", "Action", "Reason"})
+
+	summary := make(map[string]int)
+	for _, item := range m.items {
+		t.AppendRow([]interface{}{item.kind, item.path, item.action, item.reason})
+		summary[item.action]++
+	}
+
+	actions := make([]string, 0, len(summary))
+	for action := range summary {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	for _, action := range actions {
+		t.AppendFooter(table.Row{"", "", action, summary[action]})
+	}
+}
+
+// planLocalProject describes what sync would do with the local copy of the project
+func planLocalProject(action string, project *gitlab.Project, path string) (string, string) {
+	if gState != nil && gState.isProjectSynced(action, project, path) {
+		return planActionSkip, "no new activity since the last successful run"
+	}
+
+	if _, e := os.Stat(path); e != nil {
+		return planActionClone, "there is no local copy in " + path
+	}
+
+	if !newGitCommand(gCtx, path, "", "").isRepository() {
+		return planActionFail, errNotRepository.Error()
+	}
+
+	if gState == nil {
+		return planActionFetch, "local copy exists, there is no sync state"
+	}
+
+	return planActionFetch, "local copy exists, project has new activity"
+}
+
+func (m *glClient) planSync(targetDir string, mirror bool, projects []*gitlab.Project) error {
+	pln := newPlan()
+
+	for _, project := range projects {
+		action, reason := planLocalProject("sync", project, getProjectPath(targetDir, project, mirror))
+		pln.add("project", project.PathWithNamespace, action, reason)
+	}
+
+	pln.print()
+	return nil
+}
+
+func (m *migrator) planMigrate(targetDir string, tree *groupTree, projects []*gitlab.Project) error {
+	pln := newPlan()
+
+	e := tree.walk(func(node *groupNode) error {
+		var rsp *gitlab.Response
+		e := withRetries(gCtx, func() (err error) {
+			_, rsp, err = m.destination.instance.Namespaces.GetNamespace(node.group.FullPath, gitlab.WithContext(gCtx))
+			return
+		})
+		switch {
+		case e == nil:
+			pln.add("group", node.group.FullPath, planActionUntouched, "group already exists on the destination")
+		case rsp != nil && rsp.StatusCode == http.StatusNotFound:
+			pln.add("group", node.group.FullPath, planActionCreate, "group is missing on the destination")
+		default:
+			return e
+		}
+		return nil
+	})
+	if e != nil {
+		return e
+	}
+
+	spawnProjectJobsAsync("plan", jobKindAPI, projects, func(ctx context.Context, project *gitlab.Project) error {
+		action, reason := planLocalProject("migrate", project, getProjectPath(targetDir, project, true))
+		if action == planActionSkip || action == planActionFail {
+			pln.add("project", project.PathWithNamespace, action, reason)
+			return nil
+		}
+
+		_, rsp, e := m.destination.instance.Projects.GetProject(project.PathWithNamespace, nil, gitlab.WithContext(ctx))
+		switch {
+		case e == nil:
+			pln.add("project", project.PathWithNamespace, planActionPush, action+"; project already exists on the destination")
+		case rsp != nil && rsp.StatusCode == http.StatusNotFound:
+			pln.add("project", project.PathWithNamespace, planActionCreate, action+"; project is missing on the destination")
+		default:
+			pln.add("project", project.PathWithNamespace, planActionFail, e.Error())
+		}
+		return nil
+	})
+
+	pln.print()
+	return nil
+}
@@ -0,0 +1,143 @@
+package cloner
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+const (
+	scopeAPI             = "api"
+	scopeReadAPI         = "read_api"
+	scopeReadRepository  = "read_repository"
+	scopeWriteRepository = "write_repository"
+)
+
+var (
+	// scopes required by actions, source and destination instances are checked separately
+	preflightListScopes        = []string{scopeReadAPI}
+	preflightSyncScopes        = []string{scopeReadAPI, scopeReadRepository}
+	preflightDestinationScopes = []string{scopeAPI, scopeWriteRepository}
+
+	// scopes which include other ones
+	scopeSupersets = map[string][]string{
+		scopeReadAPI:         {scopeAPI},
+		scopeReadRepository:  {scopeAPI, scopeWriteRepository},
+		scopeWriteRepository: {scopeAPI},
+	}
+
+	errTokenUnauthorized = errors.New("api token is invalid, expired or revoked")
+)
+
+type tokenInfo struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Scopes    []string        `json:"scopes"`
+	Active    bool            `json:"active"`
+	Revoked   bool            `json:"revoked"`
+	ExpiresAt *gitlab.ISOTime `json:"expires_at"`
+}
+
+// getTokenInfo calls the personal access token self-info endpoint (gitlab 15.5+)
+func (m *glClient) getTokenInfo() (*tokenInfo, *gitlab.Response, error) {
+	req, e := m.instance.NewRequest(http.MethodGet, "personal_access_tokens/self", nil, nil)
+	if e != nil {
+		return nil, nil, e
+	}
+
+	info := &tokenInfo{}
+	rsp, e := m.instance.Do(req, info)
+	return info, rsp, e
+}
+
+// preflight reports token scopes and user permissions and warns if they are not enough
+// for the action; only invalid tokens stop the run
+func (m *glClient) preflight(required []string) error {
+	if gCli.Bool("skip-preflight") {
+		return nil
+	}
+
+	// job tokens have neither self-info nor the current user access
+	if m.authType == authTypeJob {
+		gLog.Debug().Msg("preflight check is not supported for job tokens, skipping")
+		return nil
+	}
+
+	var user *gitlab.User
+	var rsp *gitlab.Response
+
+	e := withRetries(gCtx, func() (err error) {
+		user, rsp, err = m.instance.Users.CurrentUser(gitlab.WithContext(gCtx))
+		return
+	})
+	if rsp != nil && rsp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %s", errTokenUnauthorized, m.endpoint.Host)
+	} else if e != nil {
+		gLog.Warn().Err(e).Msgf("could not get the current user of %s", m.endpoint.Host)
+	} else {
+		gLog.Info().Msgf("connected to %s as %s (admin: %t)", m.endpoint.Host, user.Username, user.IsAdmin)
+
+		if !user.IsAdmin {
+			gLog.Info().Msg("the user is not an admin, only groups and projects available to the user will be processed")
+		}
+	}
+
+	// scopes are known for personal access tokens only
+	if m.authType != "" && m.authType != authTypePrivate {
+		return nil
+	}
+
+	var info *tokenInfo
+	e = withRetries(gCtx, func() (err error) {
+		info, rsp, err = m.getTokenInfo()
+		return
+	})
+	if rsp != nil && rsp.StatusCode == http.StatusNotFound {
+		gLog.Debug().Msg("token self-info is not supported by the instance (or it's not a personal access token), skipping scopes check")
+		return nil
+	} else if e != nil {
+		gLog.Warn().Err(e).Msg("could not get api token info, skipping scopes check")
+		return nil
+	}
+
+	gLog.Info().Msgf("api token %q has scopes: %s", info.Name, strings.Join(info.Scopes, ", "))
+
+	if info.ExpiresAt != nil && time.Until(time.Time(*info.ExpiresAt)) < 7*24*time.Hour {
+		gLog.Warn().Msgf("api token %q expires at %s", info.Name, info.ExpiresAt.String())
+	}
+
+	if missing := getMissingScopes(info.Scopes, required); len(missing) != 0 {
+		gLog.Warn().Msgf("api token %q has no required scopes for %s: %s; the action may fail with 403 errors",
+			info.Name, m.endpoint.Host, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func getMissingScopes(scopes, required []string) (missing []string) {
+	has := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		has[scope] = true
+	}
+
+LOOP:
+	for _, scope := range required {
+		if has[scope] {
+			continue
+		}
+
+		for _, superset := range scopeSupersets[scope] {
+			if has[superset] {
+				continue LOOP
+			}
+		}
+
+		missing = append(missing, scope)
+	}
+
+	return
+}
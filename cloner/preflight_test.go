@@ -0,0 +1,33 @@
+package cloner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetMissingScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		scopes   []string
+		required []string
+		want     []string
+	}{
+		{"exact scopes", []string{"read_api", "read_repository"}, preflightSyncScopes, nil},
+		{"no scopes", nil, preflightSyncScopes, []string{"read_api", "read_repository"}},
+		{"api is a superset of all", []string{"api"}, preflightSyncScopes, nil},
+		{"write_repository includes read_repository", []string{"read_api", "write_repository"}, preflightSyncScopes, nil},
+		{"read_repository does not include read_api", []string{"read_repository"}, preflightSyncScopes, []string{"read_api"}},
+		{"read_api does not include api", []string{"read_api", "write_repository"}, preflightDestinationScopes, []string{"api"}},
+		{"read_api does not include write_repository", []string{"read_api"}, []string{"write_repository"}, []string{"write_repository"}},
+		{"unrelated scopes", []string{"read_user", "read_registry"}, preflightListScopes, []string{"read_api"}},
+		{"nothing is required", nil, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getMissingScopes(tt.scopes, tt.required); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
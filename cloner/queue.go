@@ -3,6 +3,13 @@ package cloner
 import (
 	"context"
 	"sync"
+	"time"
+)
+
+// job kinds have their own queues, workers and deadlines
+const (
+	jobKindAPI = "api"
+	jobKindGit = "git"
 )
 
 const (
@@ -15,21 +22,20 @@ const (
 )
 
 type (
+	// job is a type-erased queue job; typed ones are spawned by jobPool
 	job struct {
-		fn   func(map[string]interface{}) (interface{}, error)
-		args map[string]interface{}
+		fn      func(ctx context.Context) error
+		deliver func()
 
-		status uint8
-		result chan *jobResult
+		status  uint8
+		timeout time.Duration
 
-		collector chan *job
+		attempts    int
+		maxAttempts int
+		lastErr     error
 
 		done func()
 	}
-	jobResult struct {
-		err     error
-		payload interface{}
-	}
 	worker struct {
 		ctx context.Context
 
@@ -40,94 +46,161 @@ type (
 		ctx   context.Context
 		abort func()
 
+		kind    string
+		workers int
+
 		wg sync.WaitGroup
 
+		// jobs are not queued after the dispatcher stop, the rest ones are aborted by drain
+		mu     sync.RWMutex
+		closed bool
+
 		jobQueue   chan *job
 		workerPool chan chan *job
 	}
 
-	collector struct {
-		jobsChannel chan *job
-		payloads    []interface{}
+	// typedJob keeps arguments and the result of the jobPool function
+	typedJob[In, Out any] struct {
+		*job
 
-		wg sync.WaitGroup
+		args    In
+		payload Out
+	}
+
+	// jobPool spawns jobs of one kind into the queue and passes their results to the consumer
+	// as soon as jobs are finished; workers are blocked while the consumer is busy, so results
+	// are never piled up. The consumer is never called concurrently and gets results of all
+	// spawned jobs, aborted ones have the context error
+	jobPool[In, Out any] struct {
+		kind    string
+		name    string
+		fn      func(context.Context, In) (Out, error)
+		consume func(In, Out, error)
+
+		results chan *typedJob[In, Out]
+
+		jobsWait      sync.WaitGroup
+		collectorWait sync.WaitGroup
 	}
 )
 
-func newCollector() *collector {
-	return &collector{
-		jobsChannel: make(chan *job, gCli.Int("queue-workers")+1),
+// newJobPool returns the pool of kind queue jobs; the name describes jobs in the failed jobs report
+func newJobPool[In, Out any](kind, name string, fn func(context.Context, In) (Out, error), consume func(In, Out, error)) *jobPool[In, Out] {
+	m := &jobPool[In, Out]{
+		kind:    kind,
+		name:    name,
+		fn:      fn,
+		consume: consume,
+
+		results: make(chan *typedJob[In, Out], getQueueWorkers(kind)+1),
 	}
-}
 
-func (m *collector) collect() []interface{} {
-	defer m.wg.Done()
-	defer gLog.Debug().Msg("queue collector has been stopped")
+	m.collectorWait.Add(1)
+	go m.collect()
 
-	var jobs []*job
+	return m
+}
 
-LOOP:
-	for {
-		select {
-		case <-gCtx.Done():
-			return nil
-		case jb, ok := <-m.jobsChannel:
-			if !ok {
-				break LOOP
-			}
+func (m *jobPool[In, Out]) spawn(args In) {
+	jb := &typedJob[In, Out]{args: args}
 
-			jobs = append(jobs, jb)
+	jb.job = newJob(func(ctx context.Context) (e error) {
+		jb.payload, e = m.fn(ctx, jb.args)
+		return
+	}, func() {
+		m.results <- jb
+	}, m.jobsWait.Done)
+	jb.timeout = gCli.Duration("queue-" + m.kind + "-job-timeout")
 
-			if gCtx.Err() != nil {
-				return nil
-			}
-		}
+	m.jobsWait.Add(1)
+	if !gQueues[m.kind].push(jb.job) {
+		jb.abort(gCtx.Err())
 	}
+}
 
-	// LIFO stack implementation
-	for len(jobs) > 0 {
-		l := len(jobs) - 1
-		j := jobs[l]
+// wait blocks until all spawned jobs are finished (or aborted) and their results are consumed
+func (m *jobPool[In, Out]) wait() {
+	gLog.Debug().Msg("all jobs were spawned, waiting...")
+	m.jobsWait.Wait()
 
-		if payload, ok := j.getResult(); ok {
-			m.payloads = append(m.payloads, payload)
-			jobs = jobs[:l]
+	gLog.Debug().Msg("all jobs are executed, close collector pipeline")
+	close(m.results)
+	m.collectorWait.Wait()
+}
+
+func (m *jobPool[In, Out]) collect() {
+	defer m.collectorWait.Done()
+	defer gLog.Debug().Msg("queue collector has been stopped")
+
+	for jb := range m.results {
+		if jb.lastErr != nil {
+			gFailedJobs.add(m.kind, m.name, jb.args, jb.job)
 		}
-	}
 
-	return m.payloads
+		m.consume(jb.args, jb.payload, jb.lastErr)
+	}
 }
 
-func newJob(fn func(map[string]interface{}) (interface{}, error), args map[string]interface{}, done func()) *job {
+func newJob(fn func(ctx context.Context) error, deliver func(), done func()) *job {
 	return &job{
-		fn:   fn,
-		args: args,
+		fn:      fn,
+		deliver: deliver,
 
 		status: jobStatusCreated,
-		result: make(chan *jobResult, 1),
+
+		maxAttempts: gCli.Int("queue-job-attempts"),
 
 		done: done,
 	}
 }
 
-func (m *job) assignCollector(coll chan *job) {
-	m.collector = coll
-}
+// run calls the job function with the context derived from gCtx and limited by the job
+// deadline and retries it on transient errors with backoff; jobs interrupted by the
+// deadline or the main context are aborted
+func (m *job) run() (status uint8, e error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if m.timeout > 0 {
+		ctx, cancel = context.WithTimeout(gCtx, m.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(gCtx)
+	}
+	defer cancel()
 
-// non-blocking result pop from result channel
-func (m *job) getResult() (interface{}, bool) {
-	select {
-	case payload, ok := <-m.result:
-		if gCtx.Err() != nil {
-			break
+	for {
+		m.attempts++
+
+		if e = m.fn(ctx); e == nil {
+			m.lastErr = nil
+			return jobStatusSuccess, nil
+		}
+
+		m.lastErr = e
+		if ctx.Err() != nil {
+			return jobStatusAborted, e
+		} else if m.attempts >= m.maxAttempts || !isRetryableError(e) {
+			return jobStatusFailure, e
+		}
+
+		delay := getRetryDelay(e, m.attempts)
+		gLog.Warn().Err(e).Msgf("job has been failed, retrying in %s (attempt %d of %d)",
+			delay.Round(time.Millisecond), m.attempts+1, m.maxAttempts)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return jobStatusAborted, e
+		case <-timer.C:
 		}
-		return payload, ok
-	case <-gCtx.Done():
-		break
-	default:
-		break
 	}
-	return nil, false
+}
+
+// abort finishes the job which has not been run because of the main context cancellation
+func (m *job) abort(e error) {
+	m.status, m.lastErr = jobStatusAborted, e
+	m.deliver()
+	m.done()
 }
 
 func newWorker(ctx context.Context, workerPool chan chan *job) *worker {
@@ -155,26 +228,13 @@ func (m *worker) start() {
 		case j := <-m.jobChannel:
 			j.status = jobStatusWorking
 
-			res := &jobResult{}
-			if res.payload, res.err = j.fn(j.args); res.err != nil {
-				j.status = jobStatusFailure
-			} else {
-				j.status = jobStatusSuccess
-			}
-
-			// send result to j.getResult()
-			if j.result != nil {
-				j.result <- res
+			var e error
+			if j.status, e = j.run(); j.status == jobStatusAborted {
+				gLog.Warn().Err(e).Msg("job has been aborted by deadline or cancellation")
 			}
 
-			// send job to assigned collector if it exists
-			if j.collector != nil {
-				gLog.Debug().Msg("trying to push job into assigned collector")
-				if j == nil {
-					panic("JOB IS NILL 3")
-				}
-				j.collector <- j
-			}
+			// send result to the job pool collector
+			j.deliver()
 
 			j.done()
 
@@ -186,23 +246,49 @@ func (m *worker) start() {
 	}
 }
 
-func newPool() *pool {
+// getQueueWorkers returns the worker count of the kind queue, --queue-workers is the default one
+func getQueueWorkers(kind string) int {
+	if workers := gCli.Int(kind + "-workers"); workers > 0 {
+		return workers
+	}
+	return gCli.Int("queue-workers")
+}
+
+func newPool(kind string) *pool {
+	workers := getQueueWorkers(kind)
+
 	return &pool{
+		kind:    kind,
+		workers: workers,
+
 		jobQueue:   make(chan *job, gCli.Int("queue-job-buffer")),
-		workerPool: make(chan chan *job, gCli.Int("queue-workers")),
+		workerPool: make(chan chan *job, workers),
 	}
 }
 
-func (m *pool) getJobQueue() chan *job {
-	return m.jobQueue
+// push queues the job; false is returned if the queue subsystem is stopped
+func (m *pool) push(j *job) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return false
+	}
+
+	select {
+	case m.jobQueue <- j:
+		return true
+	case <-gCtx.Done():
+		return false
+	}
 }
 
 func (m *pool) spawnWorkers() {
-	gLog.Debug().Msg("spawning workers")
+	gLog.Debug().Msgf("spawning %d %s workers", m.workers, m.kind)
 
-	for i := 0; i < gCli.Int("queue-workers"); i++ {
+	for i := 0; i < m.workers; i++ {
 		wrk := newWorker(m.ctx, m.workerPool)
-		gLog.Debug().Msgf("worker #%d starting", i)
+		gLog.Debug().Msgf("%s worker #%d starting", m.kind, i)
 
 		m.wg.Add(1)
 		go func(wrk *worker, done func()) {
@@ -242,10 +328,27 @@ LOOP:
 		}
 	}
 
-	close(m.workerPool)
+	m.drain()
 
 	gLog.Debug().Msg("waiting for workers death")
 	m.wg.Wait()
 
 	gLog.Debug().Msg("workers dead, bye")
 }
+
+// drain aborts jobs left in the queue after the dispatcher stop, so nobody waits for them;
+// pushes waiting for the queue are finished by the main context before the queue is closed
+func (m *pool) drain() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+
+	for {
+		select {
+		case j := <-m.jobQueue:
+			j.abort(gCtx.Err())
+		default:
+			return
+		}
+	}
+}
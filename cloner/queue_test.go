@@ -0,0 +1,188 @@
+package cloner
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+// startTestQueues runs the queue subsystem with one worker per kind and a small buffer
+func startTestQueues(t *testing.T, apiTimeout time.Duration) {
+	t.Helper()
+
+	fs := flag.NewFlagSet(t.Name(), flag.ContinueOnError)
+	fs.Int("queue-workers", 1, "")
+	fs.Int("api-workers", 0, "")
+	fs.Int("git-workers", 0, "")
+	fs.Int("queue-job-buffer", 2, "")
+	fs.Int("queue-job-attempts", 3, "")
+	fs.Duration("queue-job-backoff-min", time.Millisecond, "")
+	fs.Duration("queue-job-backoff-max", time.Millisecond, "")
+	fs.Duration("queue-api-job-timeout", apiTimeout, "")
+	fs.Duration("queue-git-job-timeout", 0, "")
+
+	log := zerolog.Nop()
+	gLog, gCli = &log, cli.NewContext(cli.NewApp(), fs, nil)
+
+	gFailedJobs = newFailedJobs()
+	gCtx, gAbort = context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	gQueues = make(map[string]*pool)
+	for _, kind := range []string{jobKindAPI, jobKindGit} {
+		pool := newPool(kind)
+		gQueues[kind] = pool
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.dispatch()
+		}()
+	}
+
+	t.Cleanup(func() {
+		gAbort()
+		wg.Wait()
+	})
+}
+
+// waitTimeout fails the test if fn hangs
+func waitTimeout(t *testing.T, fn func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queue has been hung")
+	}
+}
+
+func TestJobPoolDeadline(t *testing.T) {
+	startTestQueues(t, 50*time.Millisecond)
+
+	results := make(map[int]error)
+	jobs := newJobPool(jobKindAPI, "test", func(ctx context.Context, i int) (int, error) {
+		if i == 0 {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return i, nil
+	}, func(i, _ int, e error) {
+		results[i] = e
+	})
+
+	waitTimeout(t, func() {
+		for i := 0; i < 3; i++ {
+			jobs.spawn(i)
+		}
+		jobs.wait()
+	})
+
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	if !errors.Is(results[0], context.DeadlineExceeded) {
+		t.Errorf("got %v for the job over deadline, want deadline error", results[0])
+	}
+	if results[1] != nil || results[2] != nil {
+		t.Errorf("got %v and %v for the rest jobs, want no errors", results[1], results[2])
+	}
+
+	if len(gFailedJobs.jobs) != 1 || gFailedJobs.jobs[0].Status != "aborted" {
+		t.Errorf("got failed jobs %+v, want the only aborted one", gFailedJobs.jobs)
+	}
+}
+
+func TestJobPoolCancel(t *testing.T) {
+	startTestQueues(t, 0)
+
+	const total = 10
+
+	started := make(chan struct{}, total)
+	results := make(map[int]error)
+
+	jobs := newJobPool(jobKindGit, "test", func(ctx context.Context, i int) (struct{}, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return struct{}{}, ctx.Err()
+	}, func(i int, _ struct{}, e error) {
+		results[i] = e
+	})
+
+	waitTimeout(t, func() {
+		for i := 0; i < total; i++ {
+			if i == 1 {
+				// the first job is running, the rest ones are queued or not spawned yet
+				go func() {
+					<-started
+					gAbort()
+				}()
+			}
+			jobs.spawn(i)
+		}
+		jobs.wait()
+	})
+
+	if len(results) != total {
+		t.Fatalf("got %d results, want %d", len(results), total)
+	}
+
+	for i, e := range results {
+		if !errors.Is(e, context.Canceled) {
+			t.Errorf("got %v for job %d, want cancellation error", e, i)
+		}
+	}
+
+	if len(gFailedJobs.jobs) != total {
+		t.Fatalf("got %d failed jobs, want %d", len(gFailedJobs.jobs), total)
+	}
+
+	for _, failed := range gFailedJobs.jobs {
+		if failed.Status != "aborted" {
+			t.Errorf("got failed job status %s, want aborted", failed.Status)
+		}
+	}
+}
+
+func TestJobPoolRetry(t *testing.T) {
+	startTestQueues(t, 0)
+
+	var attempts int
+	var result error = errors.New("not consumed")
+
+	jobs := newJobPool(jobKindAPI, "test", func(ctx context.Context, _ int) (int, error) {
+		if attempts++; attempts < 3 {
+			return 0, &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+		}
+		return attempts, nil
+	}, func(_, _ int, e error) {
+		result = e
+	})
+
+	waitTimeout(t, func() {
+		jobs.spawn(0)
+		jobs.wait()
+	})
+
+	if result != nil || attempts != 3 {
+		t.Errorf("got %v after %d attempts, want success after 3 ones", result, attempts)
+	}
+
+	if len(gFailedJobs.jobs) != 0 {
+		t.Errorf("got failed jobs %+v, want none", gFailedJobs.jobs)
+	}
+}
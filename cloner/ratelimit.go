@@ -0,0 +1,82 @@
+package cloner
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// apiLimiter is a token bucket shared by all workers of the gitlab client;
+// the configured rate is lowered when the instance reports its limit is almost exhausted.
+// It's called by the gitlab client before the request is sent, so waiting for the token
+// is not limited by --http-client-timeout
+type apiLimiter struct {
+	limiter *rate.Limiter
+	base    rate.Limit
+
+	mu sync.Mutex
+}
+
+func newAPILimiter(rps float64, burst int) *apiLimiter {
+	base := rate.Inf
+	if rps > 0 {
+		base = rate.Limit(rps)
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &apiLimiter{
+		limiter: rate.NewLimiter(base, burst),
+		base:    base,
+	}
+}
+
+// Wait implements gitlab.RateLimiter
+func (m *apiLimiter) Wait(ctx context.Context) error {
+	return m.limiter.Wait(ctx)
+}
+
+// adapt spreads the rest of requests (RateLimit-Remaining) until the limit reset
+// (RateLimit-Reset) if less than 10% of the limit (RateLimit-Limit) is left
+func (m *apiLimiter) adapt(rsp *http.Response) {
+	limit, e1 := strconv.Atoi(rsp.Header.Get("RateLimit-Limit"))
+	remaining, e2 := strconv.Atoi(rsp.Header.Get("RateLimit-Remaining"))
+	reset, e3 := strconv.ParseInt(rsp.Header.Get("RateLimit-Reset"), 10, 64)
+	if e1 != nil || e2 != nil || e3 != nil || limit <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, adapted := m.limiter.Limit(), m.base
+	if remaining*10 < limit {
+		adapted = rate.Limit(float64(remaining) / time.Until(time.Unix(reset, 0)).Seconds())
+
+		// the reset time is in the past or remaining requests are over
+		if adapted <= 0 || adapted > m.base {
+			adapted = m.base
+			if remaining == 0 {
+				adapted = rate.Every(time.Second)
+			}
+		}
+	}
+
+	if adapted == current {
+		return
+	}
+
+	if adapted == m.base {
+		gLog.Info().Msgf("api rate limit has been restored (remaining %d of %d)", remaining, limit)
+	} else if current == m.base {
+		gLog.Warn().Msgf("api rate limit is almost exhausted (remaining %d of %d), slowing down to %.2f rps", remaining, limit, adapted)
+	}
+
+	m.limiter.SetLimit(adapted)
+}
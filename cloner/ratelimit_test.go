@@ -0,0 +1,62 @@
+package cloner
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+func TestAPILimiterWaitsBeforeClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":1,"username":"root"}`))
+	}))
+	defer srv.Close()
+
+	fs := flag.NewFlagSet(t.Name(), flag.ContinueOnError)
+	fs.Float64("api-rps", 5, "")
+	fs.Int("api-burst", 1, "")
+	fs.Duration("http-client-timeout", 300*time.Millisecond, "")
+
+	log := zerolog.Nop()
+	gLog, gCli = &log, cli.NewContext(cli.NewApp(), fs, nil)
+
+	m := newGlClient()
+	m.endpoint, _ = url.Parse(srv.URL + "/api/v4")
+
+	var e error
+	if m.instance, e = m.setGitlabConnection(); e != nil {
+		t.Fatal(e)
+	}
+
+	// the last request waits for its token longer than the client timeout
+	const requests = 5
+
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, _, err := m.instance.Users.CurrentUser(); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("request has been failed while waiting for the rate limiter: %v", err)
+	}
+}
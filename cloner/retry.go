@@ -0,0 +1,123 @@
+package cloner
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// isRetryableError reports whether the job error is transient: gitlab api rate limits,
+// server side errors, network timeouts and failed dials; tls and unknown host errors are not
+func isRetryableError(err error) bool {
+	var errResponse *gitlab.ErrorResponse
+	if errors.As(err, &errResponse) && errResponse.Response != nil {
+		code := errResponse.Response.StatusCode
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+
+	var errDNS *net.DNSError
+	if errors.As(err, &errDNS) {
+		return errDNS.IsTimeout || errDNS.IsTemporary
+	}
+
+	var errNet net.Error
+	if errors.As(err, &errNet) && errNet.Timeout() {
+		return true
+	}
+
+	var errOp *net.OpError
+	if errors.As(err, &errOp) && errOp.Op == "dial" {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET)
+}
+
+// withRetries calls fn with the job retry policy; it's used for api calls made outside of the
+// queue (first pages, sequential walks, preflight), jobs are retried by the queue itself
+func withRetries(ctx context.Context, fn func() error) (e error) {
+	attempts := gCli.Int("queue-job-attempts")
+
+	for attempt := 1; ; attempt++ {
+		if e = fn(); e == nil || attempt >= attempts || !isRetryableError(e) || ctx.Err() != nil {
+			return
+		}
+
+		delay := getRetryDelay(e, attempt)
+		gLog.Warn().Err(e).Msgf("api request has been failed, retrying in %s (attempt %d of %d)",
+			delay.Round(time.Millisecond), attempt+1, attempts)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// getRetryDelay returns exponential backoff with jitter for the attempt;
+// Retry-After and RateLimit-Reset headers of the api response have priority
+func getRetryDelay(err error, attempt int) time.Duration {
+	var errResponse *gitlab.ErrorResponse
+	if errors.As(err, &errResponse) && errResponse.Response != nil {
+		if delay, ok := getRateLimitDelay(errResponse.Response.Header); ok {
+			return delay
+		}
+	}
+
+	min, max := gCli.Duration("queue-job-backoff-min"), gCli.Duration("queue-job-backoff-max")
+
+	delay := min
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+
+	// "equal jitter": a half of the delay is fixed, the other one is random
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int63n(half+1))
+	}
+
+	return delay
+}
+
+// getRateLimitDelay returns the delay of Retry-After (seconds or http date) or RateLimit-Reset
+// (unix time) headers; dates in the past mean no delay
+func getRateLimitDelay(header http.Header) (time.Duration, bool) {
+	if v := header.Get("Retry-After"); v != "" {
+		if seconds, e := strconv.Atoi(v); e == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+
+		if date, e := http.ParseTime(v); e == nil {
+			return untilOrZero(date), true
+		}
+	}
+
+	if v := header.Get("RateLimit-Reset"); v != "" {
+		if reset, e := strconv.ParseInt(v, 10, 64); e == nil {
+			return untilOrZero(time.Unix(reset, 0)), true
+		}
+	}
+
+	return 0, false
+}
+
+func untilOrZero(t time.Time) time.Duration {
+	if delay := time.Until(t); delay > 0 {
+		return delay
+	}
+	return 0
+}
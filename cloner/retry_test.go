@@ -0,0 +1,89 @@
+package cloner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGetRateLimitDelay(t *testing.T) {
+	now := time.Now()
+	unix := func(d time.Duration) string { return strconv.FormatInt(now.Add(d).Unix(), 10) }
+	date := func(d time.Duration) string { return now.Add(d).UTC().Format(http.TimeFormat) }
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   time.Duration
+		ok     bool
+	}{
+		{"no headers", nil, 0, false},
+		{"retry-after seconds", map[string]string{"Retry-After": "30"}, 30 * time.Second, true},
+		{"retry-after zero", map[string]string{"Retry-After": "0"}, 0, true},
+		{"retry-after date", map[string]string{"Retry-After": date(time.Minute)}, time.Minute, true},
+		{"retry-after date in the past", map[string]string{"Retry-After": date(-time.Minute)}, 0, true},
+		{"ratelimit-reset", map[string]string{"RateLimit-Reset": unix(time.Minute)}, time.Minute, true},
+		{"ratelimit-reset in the past", map[string]string{"RateLimit-Reset": unix(-time.Minute)}, 0, true},
+		{"retry-after has priority", map[string]string{"Retry-After": "5", "RateLimit-Reset": unix(time.Minute)}, 5 * time.Second, true},
+		{"invalid retry-after falls back", map[string]string{"Retry-After": "soon", "RateLimit-Reset": unix(time.Minute)}, time.Minute, true},
+		{"negative retry-after falls back", map[string]string{"Retry-After": "-5", "RateLimit-Reset": unix(time.Minute)}, time.Minute, true},
+		{"invalid headers", map[string]string{"Retry-After": "soon", "RateLimit-Reset": "later"}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range tt.header {
+				header.Set(key, value)
+			}
+
+			delay, ok := getRateLimitDelay(header)
+			if ok != tt.ok {
+				t.Fatalf("got ok %v, want %v", ok, tt.ok)
+			}
+
+			// dates have a second precision
+			if diff := delay - tt.want; delay < 0 || diff > time.Second || diff < -2*time.Second {
+				t.Errorf("got %s, want %s", delay, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	startTestQueues(t, 0)
+
+	errRetryable := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	errPermanent := errors.New("permanent")
+
+	tests := []struct {
+		name     string
+		errs     []error
+		want     error
+		attempts int
+	}{
+		{"success", []error{nil}, nil, 1},
+		{"success after retries", []error{errRetryable, errRetryable, nil}, nil, 3},
+		{"attempts are exhausted", []error{errRetryable, errRetryable, errRetryable, nil}, errRetryable, 3},
+		{"permanent error", []error{errPermanent, nil}, errPermanent, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+
+			e := withRetries(context.Background(), func() error {
+				attempts++
+				return tt.errs[attempts-1]
+			})
+
+			if !errors.Is(e, tt.want) || attempts != tt.attempts {
+				t.Errorf("got %v after %d attempts, want %v after %d", e, attempts, tt.want, tt.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package cloner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	projectStatusWorking = "working"
+	projectStatusSuccess = "success"
+	projectStatusFailure = "failure"
+)
+
+type (
+	stateDB struct {
+		db *bolt.DB
+	}
+	projectState struct {
+		ID             int               `json:"id"`
+		Path           string            `json:"path"`
+		LocalPath      string            `json:"local_path"`
+		Refs           map[string]string `json:"refs,omitempty"`
+		LastActivityAt *time.Time        `json:"last_activity_at,omitempty"`
+		Status         string            `json:"status"`
+		Error          string            `json:"error,omitempty"`
+		Duration       time.Duration     `json:"duration"`
+		UpdatedAt      time.Time         `json:"updated_at"`
+	}
+)
+
+// openStateDB opens (or creates) the sync state file; by default it is kept in the target directory
+func openStateDB() (*stateDB, error) {
+	path := gCli.String("state-file")
+	if path == "" {
+		path = filepath.Join(gCli.String("target-dir"), ".gitlabrepocloner.db")
+	}
+
+	gLog.Debug().Msgf("opening state database %s", path)
+	opts := &bolt.Options{Timeout: time.Second}
+
+	// dry runs must not leave anything on the disk
+	if gCli.Bool("dry-run") {
+		if _, e := os.Stat(path); e != nil {
+			gLog.Debug().Msg("there is no state database for the dry run")
+			return nil, nil
+		}
+		opts.ReadOnly = true
+	} else if e := os.MkdirAll(filepath.Dir(path), 0755); e != nil {
+		return nil, e
+	}
+
+	db, e := bolt.Open(path, 0600, opts)
+	if e != nil {
+		return nil, e
+	}
+
+	return &stateDB{db: db}, nil
+}
+
+func (m *stateDB) close() error {
+	return m.db.Close()
+}
+
+func (m *stateDB) getProjectState(action string, pid int) (state *projectState, e error) {
+	e = m.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(action))
+		if bucket == nil {
+			return nil
+		}
+
+		buf := bucket.Get([]byte(strconv.Itoa(pid)))
+		if buf == nil {
+			return nil
+		}
+
+		state = &projectState{}
+		return json.Unmarshal(buf, state)
+	})
+	return
+}
+
+func (m *stateDB) putProjectState(action string, state *projectState) error {
+	state.UpdatedAt = time.Now()
+
+	buf, e := json.Marshal(state)
+	if e != nil {
+		return e
+	}
+
+	return m.db.Update(func(tx *bolt.Tx) error {
+		bucket, e := tx.CreateBucketIfNotExists([]byte(action))
+		if e != nil {
+			return e
+		}
+
+		return bucket.Put([]byte(strconv.Itoa(state.ID)), buf)
+	})
+}
+
+// isProjectSynced reports whether the project has been successfully processed by the action
+// into the same local path and has no new activity since then
+func (m *stateDB) isProjectSynced(action string, project *gitlab.Project, localPath string) bool {
+	if project.LastActivityAt == nil {
+		return false
+	}
+
+	state, e := m.getProjectState(action, project.ID)
+	if e != nil {
+		gLog.Warn().Err(e).Msgf("could not read state of project %s", project.PathWithNamespace)
+		return false
+	}
+
+	return state != nil && state.Status == projectStatusSuccess && state.LocalPath == localPath &&
+		state.LastActivityAt != nil && state.LastActivityAt.Equal(*project.LastActivityAt)
+}
+
+// beginProject marks the project as in progress; refs and activity of the previous
+// successful run are kept until the current one finishes
+func (m *stateDB) beginProject(action string, project *gitlab.Project, localPath string) *projectState {
+	state, e := m.getProjectState(action, project.ID)
+	if e != nil || state == nil {
+		state = &projectState{ID: project.ID}
+	}
+
+	state.Path, state.LocalPath, state.Status, state.Error = project.PathWithNamespace, localPath, projectStatusWorking, ""
+
+	if e := m.putProjectState(action, state); e != nil {
+		gLog.Warn().Err(e).Msgf("could not save state of project %s", project.PathWithNamespace)
+	}
+
+	return state
+}
+
+func (m *stateDB) finishProject(action string, project *gitlab.Project, state *projectState, err error, duration time.Duration) {
+	state.Duration, state.Status, state.Error = duration, projectStatusSuccess, ""
+
+	if err != nil {
+		state.Status, state.Error = projectStatusFailure, err.Error()
+	} else {
+		state.LastActivityAt = project.LastActivityAt
+		state.Refs = getRepositoryRefs(state.LocalPath)
+	}
+
+	if e := m.putProjectState(action, state); e != nil {
+		gLog.Warn().Err(e).Msgf("could not save state of project %s", project.PathWithNamespace)
+	}
+}
+
+func getRepositoryRefs(path string) map[string]string {
+	out, e := newGitCommand(gCtx, path, "", "").run("for-each-ref", "--format=%(refname) %(objectname)")
+	if e != nil {
+		gLog.Warn().Err(e).Msgf("could not read refs of %s", path)
+		return nil
+	}
+
+	refs := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if ref := strings.SplitN(line, " ", 2); len(ref) == 2 {
+			refs[ref[0]] = ref[1]
+		}
+	}
+
+	return refs
+}
@@ -0,0 +1,176 @@
+package cloner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+var (
+	errSyncFailed    = errors.New("some projects could not be synced")
+	errNotRepository = errors.New("target path exists but it is not a git repository")
+)
+
+func (m *glClient) syncAction() (e error) {
+	var groups []*gitlab.Group
+	var projects []*gitlab.Project
+
+	if groups, e = m.getInstanceGroupsAsync(); e != nil {
+		return
+	}
+
+	if projects, e = m.getInstanceProjectsAsync(groups); e != nil {
+		return
+	}
+
+	if projects, e = filterProjects(projects); e != nil {
+		return
+	}
+
+	return m.syncProjectsAsync(projects)
+}
+
+func (m *glClient) syncProjectsAsync(projects []*gitlab.Project) error {
+	targetDir, mirror := gCli.String("target-dir"), gCli.Bool("mirror")
+	if gCli.Bool("dry-run") {
+		return m.planSync(targetDir, mirror, projects)
+	}
+
+	if e := os.MkdirAll(targetDir, 0755); e != nil {
+		return e
+	}
+
+	return runProjectJobsAsync("sync", targetDir, mirror, projects, func(ctx context.Context, project *gitlab.Project, path string) error {
+		return m.cloneProject(ctx, project, path, mirror)
+	})
+}
+
+// runProjectJobsAsync spawns a queue job per project and waits for all of them;
+// projects already processed by the action and unchanged since then are skipped
+func runProjectJobsAsync(action, targetDir string, mirror bool, projects []*gitlab.Project, fn func(context.Context, *gitlab.Project, string) error) error {
+	failed := spawnProjectJobsAsync(action, jobKindGit, projects, func(ctx context.Context, project *gitlab.Project) error {
+		path := getProjectPath(targetDir, project, mirror)
+		if gState.isProjectSynced(action, project, path) {
+			gLog.Info().Str("path", path).Msgf("project %s has no new activity, skipping", project.PathWithNamespace)
+			return nil
+		}
+
+		state, started := gState.beginProject(action, project, path), time.Now()
+		e := fn(ctx, project, path)
+		gState.finishProject(action, project, state, e, time.Since(started))
+
+		return e
+	})
+
+	gLog.Info().Msgf("%s has been finished; %d projects total, %d failed", action, len(projects), failed)
+
+	if e := gFailedJobs.write(action, targetDir, mirror); e != nil {
+		gLog.Error().Err(e).Msg("could not write failed jobs report")
+	}
+
+	if gCtx.Err() != nil {
+		return gCtx.Err()
+	}
+
+	// projects of failed discovery jobs are not synced too
+	if failed != 0 || gFailedJobs.count() != 0 {
+		return errSyncFailed
+	}
+
+	return nil
+}
+
+// spawnProjectJobsAsync spawns a queue job per project, waits for all of them
+// and returns the number of failed ones; projects left after the cancellation are aborted
+func spawnProjectJobsAsync(action, kind string, projects []*gitlab.Project, fn func(context.Context, *gitlab.Project) error) (failed int) {
+	jobs := newJobPool(kind, action, func(ctx context.Context, project *gitlab.Project) (struct{}, error) {
+		defer gLog.Debug().Msg("all done, job can be stopped now")
+
+		gLog.Debug().Msgf("There is new %s job for project %s", action, project.PathWithNamespace)
+		return struct{}{}, fn(ctx, project)
+	}, func(_ *gitlab.Project, _ struct{}, e error) {
+		if e != nil {
+			gLog.Error().Err(e).Msg("")
+			failed++
+		}
+	})
+
+	// job spawner:
+	for _, project := range projects {
+		jobs.spawn(project)
+	}
+
+	jobs.wait()
+
+	return
+}
+
+func getProjectPath(targetDir string, project *gitlab.Project, mirror bool) string {
+	path := filepath.Join(targetDir, filepath.FromSlash(project.PathWithNamespace))
+
+	// bare mirrors are stored as "project.git" like gitlab does on its side
+	if mirror {
+		path += ".git"
+	}
+
+	return path
+}
+
+// cloneProject clones the project into the temporary directory and moves it to the path on
+// success, so interrupted clones are never taken for existing ones
+func (m *glClient) cloneProject(ctx context.Context, project *gitlab.Project, path string, mirror bool) error {
+	if _, e := os.Stat(path); e == nil {
+		return m.fetchProject(ctx, project, path)
+	}
+
+	if e := os.MkdirAll(filepath.Dir(path), 0755); e != nil {
+		return e
+	}
+
+	// the partial clone of the killed run is removed too
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".partial")
+	if e := os.RemoveAll(tmp); e != nil {
+		return e
+	}
+
+	git := m.newGitCommand(ctx, "")
+
+	clone := git.clone
+	if mirror {
+		clone = git.mirror
+	}
+
+	if e := clone(project.HTTPURLToRepo, tmp); e != nil {
+		if err := os.RemoveAll(tmp); err != nil {
+			gLog.Warn().Err(err).Msgf("could not remove the partial clone %s", tmp)
+		}
+		return fmt.Errorf("could not clone %s: %w", project.PathWithNamespace, e)
+	}
+
+	if e := os.Rename(tmp, path); e != nil {
+		return e
+	}
+
+	gLog.Info().Str("path", path).Msgf("project %s has been cloned", project.PathWithNamespace)
+	return nil
+}
+
+func (m *glClient) fetchProject(ctx context.Context, project *gitlab.Project, path string) error {
+	git := m.newGitCommand(ctx, path)
+
+	if !git.isRepository() {
+		return fmt.Errorf("%w: %s", errNotRepository, path)
+	}
+
+	if e := git.fetch(); e != nil {
+		return fmt.Errorf("could not fetch %s: %w", project.PathWithNamespace, e)
+	}
+
+	gLog.Info().Str("path", path).Msgf("project %s has been fetched", project.PathWithNamespace)
+	return nil
+}
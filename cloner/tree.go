@@ -0,0 +1,177 @@
+package cloner
+
+import (
+	"context"
+	"sort"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+type (
+	groupNode struct {
+		group *gitlab.Group
+
+		parent   *groupNode
+		children []*groupNode
+	}
+	groupTree struct {
+		roots []*groupNode
+		nodes map[int]*groupNode
+	}
+)
+
+// newGroupTree links groups by their ParentID; groups with parents missing
+// in the given slice become tree roots
+func newGroupTree(groups []*gitlab.Group) *groupTree {
+	tree := &groupTree{
+		nodes: make(map[int]*groupNode, len(groups)),
+	}
+
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+
+		if _, ok := tree.nodes[group.ID]; !ok {
+			tree.nodes[group.ID] = &groupNode{group: group}
+		}
+	}
+
+	for _, node := range tree.nodes {
+		if parent, ok := tree.nodes[node.group.ParentID]; ok && node.group.ParentID != 0 {
+			node.parent = parent
+			parent.children = append(parent.children, node)
+			continue
+		}
+
+		tree.roots = append(tree.roots, node)
+	}
+
+	// keep walk order stable between runs
+	sortGroupNodes(tree.roots)
+	for _, node := range tree.nodes {
+		sortGroupNodes(node.children)
+	}
+
+	return tree
+}
+
+func sortGroupNodes(nodes []*groupNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].group.FullPath < nodes[j].group.FullPath
+	})
+}
+
+// walk calls fn for every group in the parent-first order and stops on the first error
+func (m *groupTree) walk(fn func(*groupNode) error) error {
+	var walkNodes func([]*groupNode) error
+	walkNodes = func(nodes []*groupNode) error {
+		for _, node := range nodes {
+			if e := fn(node); e != nil {
+				return e
+			}
+
+			if e := walkNodes(node.children); e != nil {
+				return e
+			}
+		}
+		return nil
+	}
+
+	return walkNodes(m.roots)
+}
+
+// prune returns the tree of project namespaces and their ancestors only
+func (m *groupTree) prune(projects []*gitlab.Project) *groupTree {
+	paths := make(map[string]*groupNode, len(m.nodes))
+	for _, node := range m.nodes {
+		paths[node.group.FullPath] = node
+	}
+
+	kept := make(map[int]*gitlab.Group)
+	for _, project := range projects {
+		if project.Namespace == nil {
+			continue
+		}
+
+		for node := paths[project.Namespace.FullPath]; node != nil; node = node.parent {
+			if _, ok := kept[node.group.ID]; ok {
+				break
+			}
+			kept[node.group.ID] = node.group
+		}
+	}
+
+	groups := make([]*gitlab.Group, 0, len(kept))
+	for _, group := range kept {
+		groups = append(groups, group)
+	}
+
+	return newGroupTree(groups)
+}
+
+func (m *groupTree) getGroups() (groups []*gitlab.Group) {
+	groups = make([]*gitlab.Group, 0, len(m.nodes))
+
+	_ = m.walk(func(node *groupNode) error {
+		groups = append(groups, node.group)
+		return nil
+	})
+
+	return
+}
+
+// getInstanceGroupTreeAsync fetches all descendants of the given groups and links them into a tree
+func (m *glClient) getInstanceGroupTreeAsync(groups []*gitlab.Group) (tree *groupTree, e error) {
+	descendants := append([]*gitlab.Group{}, groups...)
+
+	jobs := newJobPool(jobKindAPI, "descendant-groups", func(ctx context.Context, group *gitlab.Group) ([]*gitlab.Group, error) {
+		defer gLog.Debug().Msg("all done, job can be stopped now")
+
+		gLog.Debug().Msgf("There is new job for descendants of group %d", group.ID)
+
+		if useGraphQL() {
+			return m.getDescendantGroupsGraphQL(ctx, group.FullPath)
+		}
+
+		return m.getDescendantGroups(ctx, group.ID)
+	}, func(_ *gitlab.Group, grps []*gitlab.Group, err error) {
+		if err != nil {
+			gLog.Error().Err(err).Msg("")
+			e = err
+			return
+		}
+
+		descendants = append(descendants, grps...)
+	})
+
+	// job spawner:
+	for _, group := range groups {
+		if group == nil || gCtx.Err() != nil {
+			continue
+		}
+
+		jobs.spawn(group)
+	}
+
+	jobs.wait()
+
+	return newGroupTree(descendants), e
+}
+
+func (m *glClient) getDescendantGroups(ctx context.Context, gid int) (groups []*gitlab.Group, e error) {
+	var grps []*gitlab.Group
+	var rsp *gitlab.Response
+
+	listOptions := &gitlab.ListDescendantGroupsOptions{}
+	for listOptions.Page = 1; listOptions.Page != 0 && ctx.Err() == nil; listOptions.Page = rsp.NextPage {
+		if grps, rsp, e = m.instance.Groups.ListDescendantGroups(gid, listOptions, gitlab.WithContext(ctx)); e != nil {
+			gLog.Error().Err(e).Msg("There is abnormal result from Gitlab API")
+			return nil, e
+		}
+
+		groups = append(groups, grps...)
+	}
+
+	return
+}
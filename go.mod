@@ -1,13 +1,17 @@
 module github.com/MindHunter86/GitlabRepoCloner
 
-go 1.17
+go 1.18
 
 require (
+	github.com/hashicorp/go-retryablehttp v0.6.8
 	github.com/jedib0t/go-pretty/v6 v6.3.0
 	github.com/pkg/profile v1.6.0
 	github.com/rs/zerolog v1.26.1
 	github.com/urfave/cli/v2 v2.4.0
 	github.com/xanzy/go-gitlab v0.60.0
+	go.etcd.io/bbolt v1.3.7
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -15,13 +19,11 @@ require (
 	github.com/golang/protobuf v1.2.0 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.1 // indirect
-	github.com/hashicorp/go-retryablehttp v0.6.8 // indirect
 	github.com/mattn/go-runewidth v0.0.13 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	golang.org/x/net v0.0.0-20210805182204-aaa1db679c0d // indirect
 	golang.org/x/oauth2 v0.0.0-20181106182150-f42d05182288 // indirect
-	golang.org/x/sys v0.0.0-20210809222454-d867a43fc93e // indirect
-	golang.org/x/time v0.0.0-20191024005414-555d28b269f0 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 	google.golang.org/appengine v1.3.0 // indirect
 )
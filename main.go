@@ -69,18 +69,156 @@ func main() {
 			Name:  "http-client-insecure-ciphers",
 			Usage: "Flag for avoiding of setting TLS min version to 1.2 and using secure ciphers",
 		},
+		&cli.StringFlag{
+			Name:  "api-backend",
+			Value: "rest",
+			Usage: "Discovery `BACKEND` of groups and projects (rest, graphql); graphql needs much less requests on big instances",
+		},
+		&cli.Float64Flag{
+			Name:  "api-rps",
+			Usage: "Maximum `RPS` of api requests shared by all workers (0 - unlimited); it's lowered automatically when RateLimit-Remaining is low",
+		},
+		&cli.IntFlag{
+			Name:  "api-burst",
+			Value: 1,
+			Usage: "Maximum burst of api requests over --api-rps",
+		},
+
+		// Configuration
+		&cli.StringFlag{
+			Name:    "config",
+			Aliases: []string{"c"},
+			Usage:   "Configuration `FILE` with option values and instance profiles (default: ~/.config/gitlabrepocloner/config.yaml)",
+		},
+		&cli.StringFlag{
+			Name:    "profile",
+			Aliases: []string{"p"},
+			Usage:   "Instance profile `NAME` from the config file to use instead of the gitlab url argument (source instance for migrate)",
+		},
+
+		// Gitlab credentials
+		&cli.StringFlag{
+			Name:  "auth-type",
+			Value: "private",
+			Usage: "Api authentication `TYPE`: private (personal, project or group access token), oauth (OAuth2 bearer token), job (CI job token) or basic (username and password)",
+		},
+		&cli.StringFlag{
+			Name:  "auth-username",
+			Usage: "`USERNAME` for basic auth (netrc and credential command logins are used if it's empty)",
+		},
+		&cli.StringFlag{
+			Name:  "token-env",
+			Value: "GITLAB_TOKEN",
+			Usage: "Environment `VARIABLE` with the api token",
+		},
+		&cli.StringFlag{
+			Name:  "token-file",
+			Usage: "`FILE` with the api token",
+		},
+		&cli.StringFlag{
+			Name:  "token-command",
+			Usage: "Git credential helper style `COMMAND` printing the api token as password (called with \"get\" argument)",
+		},
+		&cli.StringFlag{
+			Name:  "netrc-file",
+			Usage: "Netrc `FILE` with api tokens as passwords (default: $NETRC or ~/.netrc)",
+		},
+
+		// Gitlab settings
+		&cli.BoolFlag{
+			Name:  "skip-preflight",
+			Usage: "Flag for skipping of api token scopes and user permissions check",
+		},
+		&cli.StringSliceFlag{
+			Name:    "group",
+			Aliases: []string{"g"},
+			Usage:   "Gitlab group full `PATH` (e.g. a/b/c) or ID to work with, may be repeated; all top-level groups are used by default",
+		},
+
+		// Project filters
+		&cli.StringFlag{
+			Name:  "manifest",
+			Usage: "Sync scope manifest `FILE` (yaml with include/exclude sections or plain text list of paths and IDs)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "include",
+			Usage: "Regular `EXPRESSION` for project paths (with namespace) to work with, may be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "exclude",
+			Usage: "Regular `EXPRESSION` for project paths (with namespace) to skip, may be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "visibility",
+			Usage: "Project `VISIBILITY` to work with (public, internal, private), may be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "topic",
+			Usage: "Project `TOPIC` to work with, may be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "archived",
+			Value: "include",
+			Usage: "Archived projects `MODE` (include, exclude, only)",
+		},
+		&cli.StringFlag{
+			Name:  "forks",
+			Value: "include",
+			Usage: "Forked projects `MODE` (include, exclude, only)",
+		},
+		&cli.DurationFlag{
+			Name:  "active-within",
+			Usage: "Work with projects which have activity within `DURATION` (format: 720h)",
+		},
+		&cli.DurationFlag{
+			Name:  "inactive-for",
+			Usage: "Work with projects which have no activity for `DURATION` (format: 720h)",
+		},
 
 		// Queue settings
 		&cli.IntFlag{
 			Name:  "queue-workers",
 			Value: 4,
-			Usage: "queue-wrokers",
+			Usage: "Default workers count of api and git job queues (see --api-workers, --git-workers)",
+		},
+		&cli.IntFlag{
+			Name:  "api-workers",
+			Usage: "Workers of the api jobs queue (pagination, discovery, metadata calls); 0 - --queue-workers",
+		},
+		&cli.IntFlag{
+			Name:  "git-workers",
+			Usage: "Workers of the git jobs queue (clone, fetch, push); 0 - --queue-workers",
 		},
 		&cli.IntFlag{
 			Name:  "queue-job-buffer",
 			Value: 128,
 			Usage: "queue-job-buffer",
 		},
+		&cli.DurationFlag{
+			Name:  "queue-api-job-timeout",
+			Value: 5 * time.Minute,
+			Usage: "Deadline of api jobs including all attempts (0 - no deadline)",
+		},
+		&cli.DurationFlag{
+			Name:  "queue-git-job-timeout",
+			Value: time.Hour,
+			Usage: "Deadline of git jobs (clone, fetch, push) including all attempts (0 - no deadline)",
+		},
+		&cli.IntFlag{
+			Name:  "queue-job-attempts",
+			Value: 3,
+			Usage: "Maximum number of job attempts; only rate limits, server errors and network failures are retried",
+		},
+		&cli.DurationFlag{
+			Name:  "queue-job-backoff-min",
+			Value: time.Second,
+			Usage: "Initial delay between job attempts, doubled with every attempt",
+		},
+		&cli.DurationFlag{
+			Name:  "queue-job-backoff-max",
+			Value: time.Minute,
+			Usage: "Maximum delay between job attempts (Retry-After and RateLimit-Reset headers are honored as is)",
+		},
 
 		// System settings
 
@@ -94,6 +232,58 @@ func main() {
 	zerolog.TimeFieldFormat = time.RFC3339Nano
 	log.Debug().Msg("starting...")
 
+	// migrate destination instance options
+	destinationFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "destination-profile",
+			Usage: "Instance profile `NAME` from the config file to use instead of the destination url argument",
+		},
+		&cli.StringFlag{
+			Name:  "destination-auth-type",
+			Value: "private",
+			Usage: "Destination api authentication `TYPE` (private, oauth, job, basic)",
+		},
+		&cli.StringFlag{
+			Name:  "destination-auth-username",
+			Usage: "Destination `USERNAME` for basic auth",
+		},
+		&cli.StringFlag{
+			Name:  "destination-token-env",
+			Value: "GITLAB_DESTINATION_TOKEN",
+			Usage: "Environment `VARIABLE` with the destination api token",
+		},
+		&cli.StringFlag{
+			Name:  "destination-token-file",
+			Usage: "`FILE` with the destination api token",
+		},
+		&cli.StringFlag{
+			Name:  "destination-token-command",
+			Usage: "Git credential helper style `COMMAND` printing the destination api token as password",
+		},
+	}
+
+	// list subcommands options
+	listFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Value:   "table",
+			Usage:   "Output `FORMAT` (table, json, yaml, csv, tsv, markdown, html); unsorted csv and tsv projects are printed while discovery is in progress",
+		},
+		&cli.StringFlag{
+			Name:  "columns",
+			Usage: "Comma separated `COLUMNS` to print, nested fields are joined with dots (e.g. id,path_with_namespace,statistics.repository_size)",
+		},
+		&cli.StringFlag{
+			Name:  "sort-by",
+			Usage: "Sort output by `COLUMN`",
+		},
+		&cli.BoolFlag{
+			Name:  "reverse",
+			Usage: "Reverse output order",
+		},
+	}
+
 	app.Commands = []*cli.Command{
 		&cli.Command{
 			Name:    "list",
@@ -103,26 +293,16 @@ func main() {
 				&cli.Command{
 					Name:  "groups",
 					Usage: "list gitlab groups",
+					Flags: listFlags,
 					Action: func(c *cli.Context) error {
-						// TODO
-						// if c.Int("verbose") < -1 || c.Int("verbose") > 5 {
-						// 	log.Fatal().Msg("There is invalid data in verbose option. Option supports values for -1 to 5")
-						// }
-
-						// zerolog.SetGlobalLevel(zerolog.Level(int8((c.Int("verbose") - 5) * -1)))
-						// if c.Int("verbose") == -1 || c.Bool("quite") {
-						// 	zerolog.SetGlobalLevel(zerolog.Disabled)
-						// }
-
-						zerolog.SetGlobalLevel(zerolog.DebugLevel)
 						return cloner.NewCloner(&log, c).PrintGroups()
 					},
 				},
 				&cli.Command{
 					Name:  "repositories",
 					Usage: "list gitlab repositories",
+					Flags: listFlags,
 					Action: func(c *cli.Context) error {
-						zerolog.SetGlobalLevel(zerolog.DebugLevel)
 						return cloner.NewCloner(&log, c).PrintRepositories()
 					},
 				},
@@ -130,10 +310,90 @@ func main() {
 		},
 		&cli.Command{
 			Name:    "sync",
-			Aliases: []string{"l"},
-			Usage:   "list gitlab components",
+			Aliases: []string{"s"},
+			Usage:   "clone all found gitlab repositories",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "target-dir",
+					Aliases: []string{"t"},
+					Value:   "./repositories",
+					Usage:   "Local `DIRECTORY` for cloned repositories (project namespaces are kept as subdirectories)",
+				},
+				&cli.StringFlag{
+					Name:  "state-file",
+					Usage: "Sync state database `FILE` used for incremental and resumed runs (default: TARGET_DIR/.gitlabrepocloner.db)",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Print the plan of changes without touching local directories or gitlab instances",
+				},
+				&cli.BoolFlag{
+					Name:  "mirror",
+					Usage: "Store projects as bare mirrors with all refs (branches, tags, notes and merge-requests; keep-around refs are hidden by gitlab)",
+				},
+				&cli.StringFlag{
+					Name:  "failed-jobs-file",
+					Usage: "Failed jobs report `FILE` written at the end of the run (default: TARGET_DIR/.gitlabrepocloner-failed.json)",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return cloner.NewCloner(&log, c).Sync()
+			},
+		},
+		&cli.Command{
+			Name:      "migrate",
+			Aliases:   []string{"m"},
+			Usage:     "migrate gitlab groups and repositories to another gitlab instance",
+			ArgsUsage: "SOURCE_URL DESTINATION_URL",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:    "target-dir",
+					Aliases: []string{"t"},
+					Value:   "./mirrors",
+					Usage:   "Local `DIRECTORY` for intermediate bare mirrors of source repositories",
+				},
+				&cli.StringFlag{
+					Name:  "state-file",
+					Usage: "Sync state database `FILE` used for incremental and resumed runs (default: TARGET_DIR/.gitlabrepocloner.db)",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Print the plan of changes without touching local directories or gitlab instances",
+				},
+				&cli.StringFlag{
+					Name:  "failed-jobs-file",
+					Usage: "Failed jobs report `FILE` written at the end of the run (default: TARGET_DIR/.gitlabrepocloner-failed.json)",
+				},
+			}, destinationFlags...),
+			Action: func(c *cli.Context) error {
+				return cloner.NewCloner(&log, c).Migrate()
+			},
+		},
+		&cli.Command{
+			Name:      "retry-failed",
+			Usage:     "rerun failed projects of the last sync or migrate run",
+			ArgsUsage: "SOURCE_URL [DESTINATION_URL]",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:    "target-dir",
+					Aliases: []string{"t"},
+					Usage:   "Local `DIRECTORY` of the failed run (default: the one saved in the failed jobs report)",
+				},
+				&cli.StringFlag{
+					Name:  "state-file",
+					Usage: "Sync state database `FILE` used for incremental and resumed runs (default: TARGET_DIR/.gitlabrepocloner.db)",
+				},
+				&cli.BoolFlag{
+					Name:  "mirror",
+					Usage: "Store projects as bare mirrors (default: the one saved in the failed jobs report)",
+				},
+				&cli.StringFlag{
+					Name:  "failed-jobs-file",
+					Usage: "Failed jobs report `FILE` written at the end of the run (default: TARGET_DIR/.gitlabrepocloner-failed.json)",
+				},
+			}, destinationFlags...),
 			Action: func(c *cli.Context) error {
-				return nil
+				return cloner.NewCloner(&log, c).RetryFailed()
 			},
 		},
 	}